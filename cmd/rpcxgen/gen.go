@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"go/format"
+	"strings"
+	"text/template"
+)
+
+var stubTemplate = template.Must(template.New("stub").Parse(`// Code generated by rpcxgen. DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+{{- range .Imports}}
+	{{.Name}} "{{.Path}}"
+{{- end}}
+)
+
+// methods of {{.Type}}
+const (
+{{- range .Methods}}
+	{{$.Const .}} = "{{$.Name}}.{{.Name}}"
+{{- end}}
+)
+
+// register methods of impl with the names used by {{.Client}},
+// registered ones are rolled back if any failed
+func {{.Register}}(core rpcx.Core, impl {{.Impl}}, m ...rpcx.MiddlewareFunc) error {
+	handlers := []struct {
+		name string
+		fn   interface{}
+	}{
+{{- range .Methods}}
+		{ {{- $.Const .}}, impl.{{.Name}}},
+{{- end}}
+	}
+	for idx, it := range handlers {
+		if err := core.Register(it.name, it.fn, m...); err != nil {
+			for _, registered := range handlers[:idx] {
+				_ = core.Unregister(registered.name)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// typed client of {{.Type}}, calls performed by Callable.Call6
+type {{.Client}} struct {
+	Callable rpcx.Callable
+	Timeout  time.Duration
+}
+
+func {{.NewClient}}(callable rpcx.Callable, timeout time.Duration) *{{.Client}} {
+	return &{{.Client}}{
+		Callable: callable,
+		Timeout:  timeout,
+	}
+}
+{{range .Methods}}
+func (this *{{$.Client}}) {{.Name}}(headers rpcx.RpcMsgHeader
+	{{- range .Params}}, {{.Name}} {{.Type}}{{end}}, mids ...rpcx.MiddlewareFunc) (
+	{{- if .Out}}out {{.Out}}, {{end}}ackHeader rpcx.RpcMsgHeader, err error) {
+{{- if .Out}}
+	rsp := new({{.OutElem}})
+	ackHeader, err = this.Callable.Call6(this.Timeout, {{$.Const .}}, headers, {{$.In .}}, rsp, mids...)
+	if err == nil {
+		out = {{if not .OutPtr}}*{{end}}rsp
+	}
+	return
+{{- else}}
+	return this.Callable.Call6(this.Timeout, {{$.Const .}}, headers, {{$.In .}}, nil, mids...)
+{{- end}}
+}
+{{end}}`))
+
+func (this *service) Const(m *method) string {
+	return this.Type + m.Name
+}
+
+// in of Call6, rpcx.Args if more than one params
+func (this *service) In(m *method) string {
+	switch len(m.Params) {
+	case 0:
+		return "nil"
+	case 1:
+		return m.Params[0].Name
+	}
+	names := make([]string, 0, len(m.Params))
+	for _, it := range m.Params {
+		names = append(names, it.Name)
+	}
+	return "rpcx.Args{" + strings.Join(names, ", ") + "}"
+}
+
+func (this *service) Client() string {
+	return this.Type + "Client"
+}
+
+func (this *service) NewClient() string {
+	return this.withPrefix("new") + "Client"
+}
+
+func (this *service) Register() string {
+	return this.withPrefix("register")
+}
+
+// prefix capitalized if type exported, e.g. NewDeviceService, newDeviceService for deviceService
+func (this *service) withPrefix(prefix string) string {
+	if this.exported {
+		prefix = strings.ToUpper(prefix[:1]) + prefix[1:]
+	}
+	return prefix + strings.ToUpper(this.Type[:1]) + this.Type[1:]
+}
+
+func generate(svc *service) ([]byte, error) {
+	imports := []importSpec{{Path: rpcxPath}, {Path: "time"}}
+	for _, it := range svc.Imports {
+		if len(it.Name) == 0 && (it.Path == rpcxPath || it.Path == "time") {
+			continue
+		}
+		imports = append(imports, it)
+	}
+	svc.Imports = imports
+	buf := &bytes.Buffer{}
+	if err := stubTemplate.Execute(buf, svc); err != nil {
+		return nil, err
+	}
+	return format.Source(buf.Bytes())
+}
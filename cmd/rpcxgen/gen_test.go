@@ -0,0 +1,36 @@
+package main
+
+import (
+	"github.com/gen-iot/std"
+	"strings"
+	"testing"
+)
+
+func TestGenerateStruct(t *testing.T) {
+	svc, err := parseService("testdata/device", "deviceService", "")
+	std.AssertError(err, "parse service")
+	std.Assert(svc.Package == "device" && svc.Impl == "*deviceService", "service mismatched")
+	std.Assert(len(svc.Methods) == 2, "GetProp and Sleep expected")
+	std.Assert(len(svc.Skipped) == 2 && svc.Skipped[0].Name == "Watch" && svc.Skipped[1].Name == "Len",
+		"Watch and Len should be skipped")
+	svc.Name = "Device"
+	src, err := generate(svc)
+	std.AssertError(err, "generate")
+	out := string(src)
+	t.Log(out)
+	for _, it := range []string{
+		`deviceServiceGetProp = "Device.GetProp"`,
+		`func registerDeviceService(core rpcx.Core, impl *deviceService, m ...rpcx.MiddlewareFunc) error`,
+		`func newDeviceServiceClient(callable rpcx.Callable, timeout time.Duration) *deviceServiceClient`,
+		`GetProp(headers rpcx.RpcMsgHeader, name string, mids ...rpcx.MiddlewareFunc) (out string, ackHeader rpcx.RpcMsgHeader, err error)`,
+		`Sleep(headers rpcx.RpcMsgHeader, err_ time.Duration, in1 bool, mids ...rpcx.MiddlewareFunc) (ackHeader rpcx.RpcMsgHeader, err error)`,
+		`rpcx.Args{err_, in1}`,
+	} {
+		std.Assert(strings.Contains(out, it), "missing "+it)
+	}
+}
+
+func TestGenerateTypeNotFound(t *testing.T) {
+	_, err := parseService("testdata/device", "notExist", "")
+	std.Assert(err != nil, "type not found expected")
+}
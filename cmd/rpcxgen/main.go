@@ -0,0 +1,62 @@
+// rpcxgen generates typed client stubs and registration helpers of rpcx handlers,
+// so that renamed or retyped handlers fail at compile time instead of runtime.
+//
+//	//go:generate rpcxgen -type DeviceService -name Device
+//
+// -type is an interface listing handlers, or a struct whose exported methods are handlers.
+// methods are named `name.Method`, same as Core.RegService.
+// for each supported method the generated file contains:
+//
+//	const DeviceServiceGetProp = "Device.GetProp"
+//	func RegisterDeviceService(core rpcx.Core, impl DeviceService, m ...rpcx.MiddlewareFunc) error
+//	func (this *DeviceServiceClient) GetProp(headers rpcx.RpcMsgHeader, name string, mids ...rpcx.MiddlewareFunc) (out string, ackHeader rpcx.RpcMsgHeader, err error)
+//
+// methods that can't be registered, e.g. stream handlers, are skipped and reported.
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("rpcxgen: ")
+	typeName := flag.String("type", "", "interface or struct declaring handlers, required")
+	name := flag.String("name", "", "service name, prefix of method names. type name if empty")
+	dir := flag.String("dir", ".", "package directory")
+	output := flag.String("output", "", "output file name, default <type>_rpcx.go in dir")
+	flag.Parse()
+	if len(*typeName) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	outFile := *output
+	if len(outFile) == 0 {
+		outFile = filepath.Join(*dir, strings.ToLower(*typeName)+"_rpcx.go")
+	}
+	svc, err := parseService(*dir, *typeName, filepath.Base(outFile))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(*name) != 0 {
+		svc.Name = *name
+	}
+	for _, it := range svc.Skipped {
+		log.Printf("%s.%s skipped: %s", svc.Type, it.Name, it.Reason)
+	}
+	if len(svc.Methods) == 0 {
+		log.Fatalf("no rpc method found in %s", svc.Type)
+	}
+	src, err := generate(svc)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := ioutil.WriteFile(outFile, src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const rpcxPath = "github.com/gen-iot/rpcx/v2"
+
+type param struct {
+	Name string
+	Type string
+}
+
+type method struct {
+	Name    string
+	Params  []param // params after context
+	Out     string  // empty if handler has no result
+	OutElem string  // type allocated for decoding result
+	OutPtr  bool
+}
+
+type skipped struct {
+	Name   string
+	Reason string
+}
+
+type importSpec struct {
+	Name string // empty if not renamed
+	Path string
+}
+
+type service struct {
+	Package  string
+	Type     string // interface or struct name
+	Impl     string // type of impl passed to register helper
+	Name     string // service name, prefix of method names
+	Methods  []*method
+	Skipped  []skipped
+	Imports  []importSpec
+	exported bool
+}
+
+// parse go files of dir except tests and skipFile, collect rpc methods of typeName.
+// typeName is an interface, or a struct whose methods are handlers
+func parseService(dir string, typeName string, skipFile string) (*service, error) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, func(info os.FileInfo) bool {
+		return !strings.HasSuffix(info.Name(), "_test.go") && info.Name() != skipFile
+	}, 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, pkg := range pkgs {
+		svc, err := parsePackage(fset, pkg, typeName)
+		if err != nil {
+			return nil, err
+		}
+		if svc != nil {
+			return svc, nil
+		}
+	}
+	return nil, fmt.Errorf("type %s not found in %s", typeName, dir)
+}
+
+func parsePackage(fset *token.FileSet, pkg *ast.Package, typeName string) (*service, error) {
+	fileNames := make([]string, 0, len(pkg.Files))
+	for fileName := range pkg.Files {
+		fileNames = append(fileNames, fileName)
+	}
+	sort.Strings(fileNames)
+	svc := &service{
+		Package:  pkg.Name,
+		Type:     typeName,
+		Impl:     typeName,
+		Name:     typeName,
+		exported: ast.IsExported(typeName),
+	}
+	var spec *ast.TypeSpec = nil
+	var specFile *ast.File = nil
+	for _, fileName := range fileNames {
+		file := pkg.Files[fileName]
+		for _, decl := range file.Decls {
+			genDecl, ok := decl.(*ast.GenDecl)
+			if !ok || genDecl.Tok != token.TYPE {
+				continue
+			}
+			for _, it := range genDecl.Specs {
+				if typeSpec := it.(*ast.TypeSpec); typeSpec.Name.Name == typeName {
+					spec, specFile = typeSpec, file
+				}
+			}
+		}
+	}
+	if spec == nil {
+		return nil, nil
+	}
+	g := &collector{fset: fset, svc: svc, imports: map[importSpec]bool{}}
+	switch t := spec.Type.(type) {
+	case *ast.InterfaceType:
+		for _, field := range t.Methods.List {
+			if len(field.Names) == 0 {
+				svc.Skipped = append(svc.Skipped, skipped{g.expr(field.Type), "embedded interface not supported"})
+				continue
+			}
+			g.add(specFile, field.Names[0].Name, field.Type.(*ast.FuncType))
+		}
+	case *ast.StructType:
+		for _, fileName := range fileNames {
+			file := pkg.Files[fileName]
+			for _, decl := range file.Decls {
+				fn, ok := decl.(*ast.FuncDecl)
+				if !ok || fn.Recv == nil || !fn.Name.IsExported() {
+					continue
+				}
+				recv := fn.Recv.List[0].Type
+				star, isPtr := recv.(*ast.StarExpr)
+				if isPtr {
+					recv = star.X
+				}
+				if ident, ok := recv.(*ast.Ident); !ok || ident.Name != typeName {
+					continue
+				}
+				if isPtr {
+					svc.Impl = "*" + typeName
+				}
+				g.add(file, fn.Name.Name, fn.Type)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("type %s is neither interface nor struct", typeName)
+	}
+	for it := range g.imports {
+		svc.Imports = append(svc.Imports, it)
+	}
+	sort.Slice(svc.Imports, func(i, j int) bool {
+		return svc.Imports[i].Path < svc.Imports[j].Path
+	})
+	return svc, nil
+}
+
+type collector struct {
+	fset    *token.FileSet
+	svc     *service
+	imports map[importSpec]bool
+}
+
+// rules same as rpcx.Core.Register, see checkInParam and checkOutParam
+func (this *collector) add(file *ast.File, name string, ft *ast.FuncType) {
+	imports := importsOf(file)
+	reason := ""
+	defer func() {
+		if len(reason) != 0 {
+			this.svc.Skipped = append(this.svc.Skipped, skipped{name, reason})
+		}
+	}()
+	params := flatten(ft.Params)
+	if len(params) == 0 || !(isSelector(params[0].Type, imports, rpcxPath, "Context") ||
+		isSelector(params[0].Type, imports, "context", "Context")) {
+		reason = "in[0]: must be rpcx.Context or context.Context"
+		return
+	}
+	m := &method{Name: name}
+	used := map[string]bool{}
+	for idx, it := range params[1:] {
+		if _, ok := it.Type.(*ast.Ellipsis); ok {
+			reason = fmt.Sprintf("in[%d]: variadic param not supported", idx+1)
+			return
+		}
+		if isSelector(it.Type, imports, rpcxPath, "Stream") {
+			reason = fmt.Sprintf("in[%d]: stream handlers have no typed stub", idx+1)
+			return
+		}
+		m.Params = append(m.Params, param{Name: paramName(it.Name, idx, used), Type: this.typeOf(it.Type, imports)})
+	}
+	results := flatten(ft.Results)
+	isErr := func(idx int) bool {
+		ident, ok := results[idx].Type.(*ast.Ident)
+		return ok && ident.Name == "error"
+	}
+	switch {
+	case len(results) == 0:
+	case len(results) == 1 && isErr(0):
+	case len(results) == 1 || (len(results) == 2 && isErr(1)):
+		if isErr(0) {
+			reason = "out[0]: must not be error"
+			return
+		}
+		m.Out = this.typeOf(results[0].Type, imports)
+		m.OutElem = m.Out
+		if star, ok := results[0].Type.(*ast.StarExpr); ok {
+			m.OutPtr = true
+			m.OutElem = this.typeOf(star.X, imports)
+		}
+	default:
+		reason = "out: must be (), (error), (out) or (out, error)"
+		return
+	}
+	this.svc.Methods = append(this.svc.Methods, m)
+}
+
+// print type, imports of package selectors recorded
+func (this *collector) typeOf(expr ast.Expr, imports map[string]importSpec) string {
+	ast.Inspect(expr, func(node ast.Node) bool {
+		sel, ok := node.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		if ident, ok := sel.X.(*ast.Ident); ok {
+			if spec, ok := imports[ident.Name]; ok {
+				this.imports[spec] = true
+			}
+		}
+		return false
+	})
+	return this.expr(expr)
+}
+
+func (this *collector) expr(expr ast.Expr) string {
+	buf := &bytes.Buffer{}
+	_ = printer.Fprint(buf, this.fset, expr)
+	return buf.String()
+}
+
+type namedExpr struct {
+	Name string
+	Type ast.Expr
+}
+
+func flatten(fields *ast.FieldList) []namedExpr {
+	out := make([]namedExpr, 0)
+	if fields == nil {
+		return out
+	}
+	for _, field := range fields.List {
+		if len(field.Names) == 0 {
+			out = append(out, namedExpr{Type: field.Type})
+			continue
+		}
+		for _, name := range field.Names {
+			out = append(out, namedExpr{Name: name.Name, Type: field.Type})
+		}
+	}
+	return out
+}
+
+// local names imported as, e.g. "rpcx" -> github.com/gen-iot/rpcx/v2
+func importsOf(file *ast.File) map[string]importSpec {
+	out := make(map[string]importSpec)
+	for _, it := range file.Imports {
+		path, _ := strconv.Unquote(it.Path.Value)
+		spec := importSpec{Path: path}
+		name := importName(path)
+		if it.Name != nil {
+			spec.Name = it.Name.Name
+			name = it.Name.Name
+		}
+		out[name] = spec
+	}
+	return out
+}
+
+// last path element, major version suffix skipped
+func importName(path string) string {
+	elems := strings.Split(path, "/")
+	name := elems[len(elems)-1]
+	if len(elems) > 1 && len(name) > 1 && name[0] == 'v' && isDigits(name[1:]) {
+		name = elems[len(elems)-2]
+	}
+	return name
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if !unicode.IsDigit(c) {
+			return false
+		}
+	}
+	return true
+}
+
+func isSelector(expr ast.Expr, imports map[string]importSpec, path, name string) bool {
+	sel, ok := expr.(*ast.SelectorExpr)
+	if !ok || sel.Sel.Name != name {
+		return false
+	}
+	ident, ok := sel.X.(*ast.Ident)
+	return ok && imports[ident.Name].Path == path
+}
+
+// names used by generated code
+var reservedNames = map[string]bool{
+	"this": true, "headers": true, "mids": true, "rsp": true, "out": true, "ackHeader": true, "err": true,
+	"rpcx": true, "time": true,
+}
+
+func paramName(name string, idx int, used map[string]bool) string {
+	if len(name) == 0 || name == "_" {
+		name = fmt.Sprintf("in%d", idx)
+	}
+	for reservedNames[name] || used[name] {
+		name += "_"
+	}
+	used[name] = true
+	return name
+}
@@ -0,0 +1,28 @@
+package device
+
+import (
+	"context"
+	rx "github.com/gen-iot/rpcx/v2"
+	"time"
+)
+
+type deviceService struct{}
+
+func (this *deviceService) GetProp(ctx rx.Context, name string) (string, error) {
+	return "", nil
+}
+
+func (this *deviceService) Sleep(ctx context.Context, err time.Duration, _ bool) error {
+	return nil
+}
+
+func (this *deviceService) Watch(ctx rx.Context, stream rx.Stream) error {
+	return nil
+}
+
+func (this *deviceService) Len() int {
+	return 0
+}
+
+func (this *deviceService) unexported(ctx rx.Context) {
+}
@@ -0,0 +1,100 @@
+package examples
+
+import (
+	"context"
+	"errors"
+	"github.com/gen-iot/liblpc/v2"
+	"github.com/gen-iot/rpcx/v2"
+	"github.com/gen-iot/std"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCallAsync(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	core, err := rpcx.New()
+	std.AssertError(err, "new rpc")
+	defer std.CloseIgnoreErr(core)
+	core.RegFuncWithName("square", func(ctx rpcx.Context, n int) (int, error) {
+		ctx.SetResponseHeader(rpcx.RpcMsgHeader{"device": ctx.RequestHeader()["device"]})
+		return n * n, nil
+	})
+	core.RegFuncWithName("sleep", func(ctx context.Context, d time.Duration) error {
+		select {
+		case <-time.After(d):
+		case <-ctx.Done():
+		}
+		return nil
+	})
+	core.Start(ctx)
+	fds, err := liblpc.MakeIpcSockpair(true)
+	std.AssertError(err, "new sock pair")
+	callee := rpcx.NewConnStreamCallable(core, fds[0], nil)
+	callee.Start()
+	defer std.CloseIgnoreErr(callee)
+	caller := rpcx.NewConnStreamCallable(core, fds[1], nil)
+	caller.Start()
+
+	const count = 200
+	outs := make([]int, count)
+	futures := make([]*rpcx.CallFuture, 0, count)
+	for i := 0; i < count; i++ {
+		futures = append(futures, caller.CallAsync(time.Second*3, "square",
+			rpcx.RpcMsgHeader{"device": "d"}, i, &outs[i]))
+	}
+	std.AssertError(rpcx.WaitAll(futures...), "wait all")
+	for i := 0; i < count; i++ {
+		std.Assert(outs[i] == i*i, "out mismatched")
+		std.Assert(futures[i].AckHeader()["device"] == "d", "ack header mismatched")
+	}
+
+	// middlewares run before request written and again once call done
+	used, done := int32(0), int32(0)
+	square := 0
+	mid := func(next rpcx.HandleFunc) rpcx.HandleFunc {
+		return func(ctx rpcx.Context) {
+			atomic.AddInt32(&used, 1)
+			next(ctx)
+			if ctx.Response() == &square {
+				atomic.AddInt32(&done, 1)
+			}
+		}
+	}
+	_, err = caller.CallAsync(time.Second*3, "square", nil, 4, &square, mid).Wait()
+	std.AssertError(err, "call square with middleware")
+	std.Assert(square == 16 && atomic.LoadInt32(&used) == 2, "middleware should be applied twice")
+	std.Assert(atomic.LoadInt32(&done) == 1, "response should be set only once call done")
+
+	slow := caller.CallAsync(time.Millisecond*100, "sleep", nil, time.Second, nil)
+	fast := caller.CallAsync(time.Second*3, "square", nil, 3, new(int))
+	select {
+	case <-slow.Done():
+		t.Fatal("slow call should not finish first")
+	case <-fast.Done():
+	}
+	_, err = slow.Wait()
+	std.Assert(err == std.ErrFutureTimeout, "timeout expected")
+	std.Assert(errors.Is(rpcx.WaitAll(fast, slow), std.ErrFutureTimeout), "wait all should report timeout")
+
+	waitCtx, waitCancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer waitCancel()
+	pending := caller.CallAsync(time.Second*3, "sleep", nil, time.Second, nil)
+	err = rpcx.WaitAllContext(waitCtx, pending)
+	std.Assert(err == context.DeadlineExceeded, "wait should stop as soon as ctx done")
+
+	closed := make(chan error, 1)
+	pending.OnDone(func(f *rpcx.CallFuture) {
+		closed <- f.Err()
+	})
+	std.AssertError(caller.Close(), "close caller")
+	select {
+	case err = <-closed:
+		std.Assert(errors.Is(err, rpcx.ErrCallableClosed), "callable closed expected")
+	case <-time.After(time.Second):
+		t.Fatal("pending future should be done after callable closed")
+	}
+	_, err = caller.CallAsync(time.Second, "square", nil, 1, nil).Wait()
+	std.Assert(errors.Is(err, rpcx.ErrCallableClosed), "callable closed expected")
+}
@@ -0,0 +1,67 @@
+package examples
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gen-iot/liblpc/v2"
+	"github.com/gen-iot/rpcx/v2"
+	"github.com/gen-iot/std"
+	"testing"
+	"time"
+)
+
+var errNoSuchProp = errors.New("no such prop")
+
+func TestBatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	core, err := rpcx.New()
+	std.AssertError(err, "new rpc")
+	defer std.CloseIgnoreErr(core)
+	core.RegFuncWithName("getProp", func(ctx rpcx.Context, name string) (string, error) {
+		if name == "missing" {
+			return "", errNoSuchProp
+		}
+		time.Sleep(time.Millisecond * 50)
+		return "value of " + name, nil
+	})
+	core.Start(ctx)
+	fds, err := liblpc.MakeIpcSockpair(true)
+	std.AssertError(err, "new sock pair")
+	callee := rpcx.NewConnStreamCallable(core, fds[0], nil)
+	callee.Start()
+	defer std.CloseIgnoreErr(callee)
+	caller := rpcx.NewConnStreamCallable(core, fds[1], nil)
+	caller.Start()
+	defer std.CloseIgnoreErr(caller)
+
+	for _, parallel := range []bool{false, true} {
+		batch := caller.Batch().SetParallel(parallel)
+		outs := make([]*string, 0)
+		calls := make([]*rpcx.BatchCall, 0)
+		for i := 0; i < 10; i++ {
+			out := new(string)
+			outs = append(outs, out)
+			calls = append(calls, batch.Add("getProp", fmt.Sprintf("prop%d", i), out))
+		}
+		missing := batch.Add("getProp", "missing", new(string))
+		notFound := batch.Add("notExist", nil, nil)
+		begin := time.Now()
+		err = batch.Do(time.Second * 3)
+		cost := time.Since(begin)
+		t.Log("parallel:", parallel, ",cost:", cost)
+		std.AssertError(err, "batch do")
+		for i, call := range calls {
+			std.AssertError(call.Err(), "batch call")
+			std.Assert(*outs[i] == fmt.Sprintf("value of prop%d", i), "batch out mismatched")
+		}
+		std.Assert(missing.Err() != nil && missing.Err().Error() == errNoSuchProp.Error(), "error should be returned per call")
+		std.Assert(errors.Is(notFound.Err(), rpcx.ErrFuncNotFound), "func not found should be returned per call")
+		if parallel {
+			std.Assert(cost < time.Millisecond*300, "parallel batch should be faster")
+		} else {
+			std.Assert(cost >= time.Millisecond*500, "batch calls should be handled in order")
+		}
+	}
+}
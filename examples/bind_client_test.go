@@ -0,0 +1,97 @@
+package examples
+
+import (
+	"context"
+	"errors"
+	"github.com/gen-iot/liblpc/v2"
+	"github.com/gen-iot/rpcx/v2"
+	"github.com/gen-iot/std"
+	"testing"
+	"time"
+)
+
+type rebootReq struct {
+	Delay int `json:"delay"`
+}
+
+type rebootRsp struct {
+	Accepted bool `json:"accepted"`
+}
+
+type deviceAPI struct {
+	Reboot  func(ctx context.Context, in *rebootReq) (*rebootRsp, error)
+	GetProp func(name string) (string, error)
+	Add     func(a, b int) (int, error)
+	Ping    func() error                    `rpcx:"ping"`
+	Slow    func(ctx context.Context) error `rpcx:",timeout=100ms"`
+	Version string
+}
+
+func TestBindClient(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	core, err := rpcx.New()
+	std.AssertError(err, "new rpc")
+	defer std.CloseIgnoreErr(core)
+	core.RegFuncWithName("Device.Reboot", func(ctx rpcx.Context, req *rebootReq) (*rebootRsp, error) {
+		return &rebootRsp{Accepted: req.Delay >= 0 && ctx.RequestHeader()["token"] == "secret"}, nil
+	})
+	core.RegFuncWithName("Device.GetProp", func(ctx rpcx.Context, name string) (string, error) {
+		if name == "missing" {
+			return "", rpcx.NewError(rpcx.CodeUserDefined+2, "no such prop")
+		}
+		return "value of " + name, nil
+	})
+	core.RegFuncWithName("Device.Add", func(ctx context.Context, a, b int) int {
+		return a + b
+	})
+	core.RegFuncWithName("ping", func(ctx rpcx.Context) {})
+	core.RegFuncWithName("Device.Slow", func(ctx rpcx.Context) {
+		time.Sleep(time.Millisecond * 500)
+	})
+	core.Start(ctx)
+	fds, err := liblpc.MakeIpcSockpair(true)
+	std.AssertError(err, "new sock pair")
+	callee := rpcx.NewConnStreamCallable(core, fds[0], nil)
+	callee.Start()
+	defer std.CloseIgnoreErr(callee)
+	caller := rpcx.NewConnStreamCallable(core, fds[1], nil)
+	caller.Start()
+	defer std.CloseIgnoreErr(caller)
+
+	api := &deviceAPI{}
+	err = rpcx.BindClient(caller, api, &rpcx.BindOptions{
+		Service: "Device",
+		Timeout: time.Second * 3,
+		Headers: rpcx.RpcMsgHeader{"token": "secret"},
+	})
+	std.AssertError(err, "bind client")
+	rsp, err := api.Reboot(context.Background(), &rebootReq{Delay: 1})
+	std.AssertError(err, "reboot")
+	std.Assert(rsp.Accepted, "reboot not accepted")
+	// nil ctx falls back to context.Background()
+	rsp, err = api.Reboot(nil, &rebootReq{Delay: 1})
+	std.AssertError(err, "reboot with nil ctx")
+	std.Assert(rsp.Accepted, "reboot with nil ctx not accepted")
+	prop, err := api.GetProp("temp")
+	std.AssertError(err, "get prop")
+	std.Assert(prop == "value of temp", "prop mismatched")
+	prop, err = api.GetProp("missing")
+	rpcErr := rpcx.AsError(err)
+	std.Assert(prop == "" && rpcErr != nil && rpcErr.Code == rpcx.CodeUserDefined+2, "no such prop expected")
+	sum, err := api.Add(1, 2)
+	std.AssertError(err, "add")
+	std.Assert(sum == 3, "sum mismatched")
+	std.AssertError(api.Ping(), "ping")
+	start := time.Now()
+	err = api.Slow(context.Background())
+	std.Assert(errors.Is(err, context.DeadlineExceeded), "timeout tag should apply")
+	std.Assert(time.Since(start) < time.Millisecond*400, "slow call should time out early")
+
+	bad := &struct {
+		Reboot func(in *rebootReq) *rebootRsp
+	}{}
+	err = rpcx.BindClient(caller, bad, nil)
+	std.Assert(errors.Is(err, rpcx.ErrInvalidSignature), "invalid signature expected")
+	std.Assert(bad.Reboot == nil, "no field should be set")
+}
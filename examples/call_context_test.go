@@ -0,0 +1,87 @@
+package examples
+
+import (
+	"context"
+	"github.com/gen-iot/liblpc/v2"
+	"github.com/gen-iot/rpcx/v2"
+	"github.com/gen-iot/std"
+	"testing"
+	"time"
+)
+
+func TestCallContextCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	core, err := rpcx.New()
+	std.AssertError(err, "new rpc")
+	defer std.CloseIgnoreErr(core)
+	core.RegFuncWithName("slow", func(ctx rpcx.Context, in string) (string, error) {
+		time.Sleep(time.Second * 3)
+		return in, nil
+	})
+	core.RegFuncWithName("echo", func(ctx rpcx.Context, in string) (string, error) {
+		return in, nil
+	})
+	core.Start(ctx)
+	fds, err := liblpc.MakeIpcSockpair(true)
+	std.AssertError(err, "new sock pair")
+	callee := rpcx.NewConnStreamCallable(core, fds[0], nil)
+	callee.Start()
+	caller := rpcx.NewConnStreamCallable(core, fds[1], nil)
+	caller.Start()
+
+	out := new(string)
+	_, err = caller.CallContext(context.Background(), "echo", nil, "hello", out)
+	std.AssertError(err, "call echo")
+	std.Assert(*out == "hello", "echo mismatched")
+
+	callCtx, callCancel := context.WithCancel(context.Background())
+	time.AfterFunc(time.Millisecond*200, callCancel)
+	begin := time.Now()
+	_, err = caller.CallContext(callCtx, "slow", nil, "hello", out)
+	t.Log("call err:", err, ",cost:", time.Since(begin))
+	std.Assert(err == context.Canceled, "should report ctx.Err()")
+	std.Assert(time.Since(begin) < time.Second, "should return as soon as ctx done")
+}
+
+func TestCalleeCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	core, err := rpcx.New()
+	std.AssertError(err, "new rpc")
+	defer std.CloseIgnoreErr(core)
+	stopped := make(chan error, 1)
+	deadlines := make(chan bool, 1)
+	core.RegFuncWithName("longRunning", func(ctx rpcx.Context) error {
+		_, hasDeadline := ctx.Deadline()
+		deadlines <- hasDeadline
+		select {
+		case <-ctx.Done():
+			stopped <- ctx.GoContext().Err()
+		case <-time.After(time.Second * 5):
+			stopped <- nil
+		}
+		return nil
+	})
+	core.Start(ctx)
+	fds, err := liblpc.MakeIpcSockpair(true)
+	std.AssertError(err, "new sock pair")
+	callee := rpcx.NewConnStreamCallable(core, fds[0], nil)
+	callee.Start()
+	caller := rpcx.NewConnStreamCallable(core, fds[1], nil)
+	caller.Start()
+
+	// caller cancel
+	callCtx, callCancel := context.WithCancel(context.Background())
+	time.AfterFunc(time.Millisecond*200, callCancel)
+	_, err = caller.CallContext(callCtx, "longRunning", nil, nil, nil)
+	std.Assert(err == context.Canceled, "caller should be canceled")
+	std.Assert(!<-deadlines, "callee should not have deadline")
+	std.Assert(<-stopped == context.Canceled, "callee should be canceled")
+
+	// caller timeout
+	err = caller.Call(time.Millisecond*200, "longRunning")
+	std.Assert(err == std.ErrFutureTimeout, "caller should timeout")
+	std.Assert(<-deadlines, "callee should receive caller deadline")
+	std.Assert(<-stopped != nil, "callee should stop early")
+}
@@ -0,0 +1,41 @@
+package examples
+
+import (
+	"context"
+	"github.com/gen-iot/liblpc/v2"
+	"github.com/gen-iot/rpcx/v2"
+	"github.com/gen-iot/std"
+	"testing"
+	"time"
+)
+
+func TestPendingCallFailOnClose(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	core, err := rpcx.New()
+	std.AssertError(err, "new rpc")
+	defer std.CloseIgnoreErr(core)
+	core.RegFuncWithName("slow", func(ctx rpcx.Context) error {
+		time.Sleep(time.Second * 3)
+		return nil
+	})
+	core.Start(ctx)
+	fds, err := liblpc.MakeIpcSockpair(true)
+	std.AssertError(err, "new sock pair")
+	callee := rpcx.NewConnStreamCallable(core, fds[0], nil)
+	callee.Start()
+	caller := rpcx.NewConnStreamCallable(core, fds[1], nil)
+	caller.Start()
+
+	time.AfterFunc(time.Millisecond*200, func() {
+		std.CloseIgnoreErr(callee)
+	})
+	begin := time.Now()
+	err = caller.Call(time.Second*10, "slow")
+	t.Log("call err:", err, ",cost:", time.Since(begin))
+	std.Assert(err == rpcx.ErrCallableClosed, "should fail with ErrCallableClosed")
+	std.Assert(time.Since(begin) < time.Second*2, "should fail immediately")
+
+	err = caller.Call(time.Second*10, "slow")
+	std.Assert(err == rpcx.ErrCallableClosed, "call on closed callable should fail")
+}
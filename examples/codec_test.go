@@ -0,0 +1,56 @@
+package examples
+
+import (
+	"context"
+	"github.com/gen-iot/liblpc/v2"
+	"github.com/gen-iot/rpcx/v2"
+	"github.com/gen-iot/rpcx/v2/middleware"
+	"github.com/gen-iot/std"
+	"testing"
+	"time"
+)
+
+type codecReq struct {
+	A int `json:"a"`
+	B int `json:"b"`
+}
+
+type codecRsp struct {
+	Sum int `json:"sum"`
+}
+
+func TestMixedCodec(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// msgpack speaking core
+	core1, err := rpcx.New()
+	std.AssertError(err, "new rpc")
+	defer std.CloseIgnoreErr(core1)
+	core1.RegFuncWithName("sum", func(ctx rpcx.Context, req *codecReq) (*codecRsp, error) {
+		return &codecRsp{Sum: req.A + req.B}, nil
+	})
+	core1.Start(ctx)
+	// json speaking core
+	core2, err := rpcx.New()
+	std.AssertError(err, "new rpc")
+	defer std.CloseIgnoreErr(core2)
+	core2.SetCodec(rpcx.JsonCodec)
+	core2.Start(ctx)
+
+	fds, err := liblpc.MakeIpcSockpair(true)
+	std.AssertError(err, "new sock pair")
+	callee := rpcx.NewConnStreamCallable(core1, fds[0], nil)
+	callee.Start()
+	caller := rpcx.NewConnStreamCallable(core2, fds[1], nil)
+	caller.Start()
+
+	rsp := new(codecRsp)
+	err = caller.Call5(time.Second*5, "sum", &codecReq{A: 1, B: 2}, rsp)
+	std.AssertError(err, "call sum with json")
+	std.Assert(rsp.Sum == 3, "json sum mismatched")
+
+	rsp = new(codecRsp)
+	err = caller.Call5(time.Second*5, "sum", &codecReq{A: 3, B: 4}, rsp, middleware.Codec(rpcx.GobCodec))
+	std.AssertError(err, "call sum with gob")
+	std.Assert(rsp.Sum == 7, "gob sum mismatched")
+}
@@ -0,0 +1,47 @@
+package examples
+
+import (
+	"context"
+	"github.com/gen-iot/rpcx/v2"
+	"github.com/gen-iot/std"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCompactMsgId(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	core, err := rpcx.New()
+	std.AssertError(err, "new rpc")
+	defer std.CloseIgnoreErr(core)
+	ids := make(chan string, 4)
+	core.RegFuncWithName("sum", func(ctx rpcx.Context, in []int) (int, error) {
+		ids <- ctx.Id()
+		out := 0
+		for _, v := range in {
+			out += v
+		}
+		return out, nil
+	})
+	core.Start(ctx)
+
+	callee, caller := newHandshakePair(core, &rpcx.HandshakeOptions{PeerId: "server"},
+		&rpcx.HandshakeOptions{PeerId: "device-1"})
+	defer std.CloseIgnoreErr(callee)
+	defer std.CloseIgnoreErr(caller)
+	std.AssertError(waitReady(caller), "caller handshake")
+	std.AssertError(waitReady(callee), "callee handshake")
+	std.Assert(caller.Peer().Supports(rpcx.FeatureCompactId), "compact id should be supported")
+
+	for i := 0; i < 3; i++ {
+		out := 0
+		err = caller.Call5(time.Second*3, "sum", []int{1, 2, i}, &out)
+		std.AssertError(err, "call sum")
+		std.Assert(out == 3+i, "sum mismatched")
+		id := <-ids
+		t.Log("callee got msg id:", id)
+		// seqs issued by caller are rebuilt in peer namespace of callee
+		std.Assert(strings.Contains(id, "@"), "compact id should be used")
+	}
+}
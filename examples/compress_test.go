@@ -0,0 +1,62 @@
+package examples
+
+import (
+	"context"
+	"github.com/gen-iot/liblpc/v2"
+	"github.com/gen-iot/rpcx/v2"
+	"github.com/gen-iot/std"
+	"strings"
+	"testing"
+	"time"
+)
+
+type deviceLog struct {
+	DeviceId string   `json:"deviceId"`
+	Lines    []string `json:"lines"`
+}
+
+func TestCompression(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	core1, err := rpcx.New()
+	std.AssertError(err, "new rpc")
+	defer std.CloseIgnoreErr(core1)
+	core1.SetCompression(&rpcx.CompressionOptions{Name: rpcx.CompressDeflate})
+	echo := func(ctx rpcx.Context, in *deviceLog) (*deviceLog, error) {
+		return in, nil
+	}
+	core1.RegFuncWithName("upload", echo)
+	core1.RegFuncWithName("uploadRaw", echo)
+	core1.Start(ctx)
+	core2, err := rpcx.New()
+	std.AssertError(err, "new rpc")
+	defer std.CloseIgnoreErr(core2)
+	core2.SetCompression(&rpcx.CompressionOptions{Name: rpcx.CompressGzip, Threshold: 512})
+	core2.SetMethodCompression("uploadRaw", nil)
+	core2.Start(ctx)
+
+	fds, err := liblpc.MakeIpcSockpair(true)
+	std.AssertError(err, "new sock pair")
+	callee := rpcx.NewSignalCallable(rpcx.NewConnStreamCallable(core1, fds[0], nil))
+	callee.SetHandshake(&rpcx.HandshakeOptions{PeerId: "server"})
+	callee.Start()
+	defer std.CloseIgnoreErr(callee)
+	caller := rpcx.NewSignalCallable(rpcx.NewConnStreamCallable(core2, fds[1], nil))
+	caller.SetHandshake(&rpcx.HandshakeOptions{PeerId: "device-1"})
+	caller.Start()
+	defer std.CloseIgnoreErr(caller)
+	std.AssertError(waitReady(caller), "caller handshake")
+	std.Assert(caller.Peer().SupportsCompression(rpcx.CompressDeflate), "deflate should be supported")
+
+	in := &deviceLog{
+		DeviceId: "device-1",
+		Lines:    strings.Split(strings.Repeat("boot ok,sensor ok,", 1024), ","),
+	}
+	for _, method := range []string{"upload", "uploadRaw"} {
+		out := new(deviceLog)
+		err = caller.Call5(time.Second*3, method, in, out)
+		std.AssertError(err, "call "+method)
+		std.Assert(out.DeviceId == in.DeviceId && len(out.Lines) == len(in.Lines), "echo mismatched")
+	}
+	std.Assert(core2.Compression("uploadRaw") == nil, "method compression should override core")
+}
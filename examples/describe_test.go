@@ -0,0 +1,66 @@
+package examples
+
+import (
+	"context"
+	"github.com/gen-iot/liblpc/v2"
+	"github.com/gen-iot/rpcx/v2"
+	"github.com/gen-iot/std"
+	"testing"
+	"time"
+)
+
+type describeNode struct {
+	Name     string          `json:"name" validate:"required"`
+	Children []*describeNode `json:"children,omitempty"`
+	Alias    string          `json:"alias" msgpack:"a"`
+	Ignored  string          `json:"-"`
+	internal int
+}
+
+func TestDescribe(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	core, err := rpcx.New()
+	std.AssertError(err, "new rpc")
+	defer std.CloseIgnoreErr(core)
+	core.RegFuncWithName("tree", func(ctx rpcx.Context, root *describeNode) (map[string]int, error) {
+		return nil, nil
+	})
+	core.RegFuncWithName("add", func(ctx context.Context, a, b int) int {
+		return a + b
+	})
+	core.EnableDescribe()
+	core.Start(ctx)
+	fds, err := liblpc.MakeIpcSockpair(true)
+	std.AssertError(err, "new sock pair")
+	callee := rpcx.NewConnStreamCallable(core, fds[0], nil)
+	callee.Start()
+	defer std.CloseIgnoreErr(callee)
+	caller := rpcx.NewConnStreamCallable(core, fds[1], nil)
+	caller.Start()
+	defer std.CloseIgnoreErr(caller)
+
+	methods := make([]*rpcx.MethodSchema, 0)
+	err = caller.Call5(time.Second*3, rpcx.DescribeMethod, nil, &methods)
+	std.AssertError(err, "call describe")
+	std.Assert(len(methods) == 3, "3 methods expected")
+	std.Assert(methods[0].Name == "add" && methods[1].Name == rpcx.DescribeMethod && methods[2].Name == "tree",
+		"methods should be sorted by name")
+
+	add := methods[0]
+	std.Assert(add.GoContext && !add.ReturnsError && len(add.Params) == 2, "add signature mismatched")
+	std.Assert(add.Params[0].Kind == "int" && add.Result.Kind == "int", "add types mismatched")
+
+	tree := methods[2]
+	std.Assert(tree.ReturnsError && len(tree.Params) == 1, "tree signature mismatched")
+	root := tree.Params[0]
+	std.Assert(root.Nullable && root.Kind == "struct" && len(root.Fields) == 3, "unexported and `-` fields should be skipped")
+	name := root.Fields[0]
+	std.Assert(name.Json == "name" && name.MsgPack == "name" && name.Validate == "required", "name field mismatched")
+	children := root.Fields[1]
+	std.Assert(children.OmitEmpty && children.Schema.Kind == "slice", "children field mismatched")
+	std.Assert(children.Schema.Elem.Ref == "examples.describeNode" && children.Schema.Elem.Fields == nil,
+		"recursive type should end with ref")
+	std.Assert(root.Fields[2].MsgPack == "a", "msgpack tag should be preferred")
+	std.Assert(tree.Result.Kind == "map" && tree.Result.Key.Kind == "string", "tree result mismatched")
+}
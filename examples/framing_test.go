@@ -0,0 +1,53 @@
+package examples
+
+import (
+	"context"
+	"github.com/gen-iot/liblpc/v2"
+	"github.com/gen-iot/rpcx/v2"
+	"github.com/gen-iot/std"
+	"testing"
+	"time"
+)
+
+func TestFramingNegotiation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for _, legacy := range []bool{false, true} {
+		core1, err := rpcx.New()
+		std.AssertError(err, "new rpc")
+		core1.RegFuncWithName("ping", func(ctx rpcx.Context) error {
+			return nil
+		})
+		core1.Start(ctx)
+		core2, err := rpcx.New()
+		std.AssertError(err, "new rpc")
+		if legacy {
+			core2.SetFraming(rpcx.FramingV2)
+		}
+		core2.Start(ctx)
+
+		fds, err := liblpc.MakeIpcSockpair(true)
+		std.AssertError(err, "new sock pair")
+		callee := rpcx.NewSignalCallable(rpcx.NewConnStreamCallable(core1, fds[0], nil))
+		callee.SetHandshake(&rpcx.HandshakeOptions{PeerId: "callee"})
+		callee.Start()
+		caller := rpcx.NewSignalCallable(rpcx.NewConnStreamCallable(core2, fds[1], nil))
+		caller.SetHandshake(&rpcx.HandshakeOptions{PeerId: "caller"})
+		caller.Start()
+		std.AssertError(waitReady(caller), "caller handshake")
+		std.AssertError(waitReady(callee), "callee handshake")
+		std.AssertError(caller.Call(time.Second*3, "ping"), "call ping")
+
+		expect := rpcx.FramingV3
+		if legacy {
+			expect = rpcx.FramingV2
+		}
+		t.Log("legacy:", legacy, ",caller framing:", caller.Framing(), ",callee framing:", callee.Framing())
+		std.Assert(caller.Framing() == expect, "caller framing mismatched")
+		std.Assert(callee.Framing() == expect, "callee framing mismatched")
+		std.CloseIgnoreErr(caller)
+		std.CloseIgnoreErr(callee)
+		std.CloseIgnoreErr(core1)
+		std.CloseIgnoreErr(core2)
+	}
+}
@@ -0,0 +1,126 @@
+package examples
+
+import (
+	"context"
+	"errors"
+	"github.com/gen-iot/liblpc/v2"
+	"github.com/gen-iot/rpcx/v2"
+	"github.com/gen-iot/std"
+	"testing"
+	"time"
+)
+
+var errBadToken = errors.New("bad token")
+
+func checkToken(call rpcx.Callable, peer *rpcx.PeerInfo) error {
+	if peer.Credentials["token"] != "secret" {
+		return errBadToken
+	}
+	return nil
+}
+
+func waitReady(call *rpcx.SignalCallable) error {
+	select {
+	case err := <-call.ReadySignal():
+		return err
+	case <-time.After(time.Second * 3):
+		return errors.New("wait ready timeout")
+	}
+}
+
+func newHandshakePair(core rpcx.Core, calleeOpts, callerOpts *rpcx.HandshakeOptions) (callee, caller *rpcx.SignalCallable) {
+	fds, err := liblpc.MakeIpcSockpair(true)
+	std.AssertError(err, "new sock pair")
+	callee = rpcx.NewSignalCallable(rpcx.NewConnStreamCallable(core, fds[0], nil))
+	callee.SetHandshake(calleeOpts)
+	caller = rpcx.NewSignalCallable(rpcx.NewConnStreamCallable(core, fds[1], nil))
+	caller.SetHandshake(callerOpts)
+	callee.Start()
+	caller.Start()
+	return
+}
+
+func TestHandshake(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	core, err := rpcx.New()
+	std.AssertError(err, "new rpc")
+	defer std.CloseIgnoreErr(core)
+	core.RegFuncWithName("whoami", func(ctx rpcx.Context) (string, error) {
+		return ctx.Callable().Peer().Id, nil
+	})
+	core.Start(ctx)
+
+	callee, caller := newHandshakePair(core, &rpcx.HandshakeOptions{
+		PeerId:       "server",
+		Authenticate: checkToken,
+	}, &rpcx.HandshakeOptions{
+		PeerId:      "device-1",
+		Credentials: map[string]string{"token": "secret"},
+	})
+	defer std.CloseIgnoreErr(callee)
+	defer std.CloseIgnoreErr(caller)
+	std.AssertError(waitReady(callee), "callee handshake")
+	std.AssertError(waitReady(caller), "caller handshake")
+	std.Assert(caller.Peer().Id == "server", "caller peer mismatched")
+	std.Assert(caller.Peer().Version == rpcx.ProtocolVersion, "protocol version mismatched")
+	std.Assert(caller.Peer().SupportsCodec(rpcx.CodecJson), "json codec should be supported")
+	std.Assert(caller.Peer().Supports(rpcx.FeatureStream), "stream should be supported")
+
+	out := ""
+	err = caller.Call3(time.Second*3, "whoami", &out)
+	std.AssertError(err, "call whoami")
+	std.Assert(out == "device-1", "callee should know caller identity")
+}
+
+func TestHandshakeRejected(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	core, err := rpcx.New()
+	std.AssertError(err, "new rpc")
+	defer std.CloseIgnoreErr(core)
+	core.Start(ctx)
+
+	callee, caller := newHandshakePair(core, &rpcx.HandshakeOptions{
+		PeerId:       "server",
+		Authenticate: checkToken,
+	}, &rpcx.HandshakeOptions{
+		PeerId:      "device-2",
+		Credentials: map[string]string{"token": "wrong"},
+	})
+	defer std.CloseIgnoreErr(callee)
+	defer std.CloseIgnoreErr(caller)
+	err = waitReady(callee)
+	t.Log("callee ready err:", err)
+	std.Assert(errors.Is(err, rpcx.ErrHandshakeRejected), "callee should reject caller")
+	std.Assert(callee.Peer() == nil, "rejected peer should not be stored")
+	err = waitReady(caller)
+	t.Log("caller ready err:", err)
+	std.Assert(errors.Is(err, rpcx.ErrHandshakeRejected), "caller should be rejected")
+
+	err = caller.Call(time.Second*3, "anything")
+	std.Assert(err != nil, "call should fail after handshake rejected")
+}
+
+func TestHandshakeOneSide(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	core, err := rpcx.New()
+	std.AssertError(err, "new rpc")
+	defer std.CloseIgnoreErr(core)
+	core.RegFuncWithName("ping", func(ctx rpcx.Context) error {
+		return nil
+	})
+	core.Start(ctx)
+
+	// callee doesn't enable handshake, but still answer hello
+	callee, caller := newHandshakePair(core, nil, &rpcx.HandshakeOptions{
+		PeerId: "device-3",
+	})
+	defer std.CloseIgnoreErr(callee)
+	defer std.CloseIgnoreErr(caller)
+	std.AssertError(waitReady(caller), "caller handshake")
+	std.Assert(caller.Peer() != nil, "caller should know peer")
+	std.AssertError(caller.Call(time.Second*3, "ping"), "call ping")
+	std.Assert(callee.Peer().Id == "device-3", "callee should know caller identity")
+}
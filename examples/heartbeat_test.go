@@ -0,0 +1,59 @@
+package examples
+
+import (
+	"context"
+	"github.com/gen-iot/liblpc/v2"
+	"github.com/gen-iot/rpcx/v2"
+	"github.com/gen-iot/std"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestHeartbeatRTT(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	core, err := rpcx.New()
+	std.AssertError(err, "new rpc")
+	defer std.CloseIgnoreErr(core)
+	core.Start(ctx)
+	fds, err := liblpc.MakeIpcSockpair(true)
+	std.AssertError(err, "new sock pair")
+	callee := rpcx.NewConnStreamCallable(core, fds[0], nil)
+	callee.Start()
+	caller := rpcx.NewSignalCallable(rpcx.NewConnStreamCallable(core, fds[1], nil))
+	caller.SetHeartbeat(time.Millisecond*50, 2)
+	caller.Start()
+	defer std.CloseIgnoreErr(caller)
+
+	time.Sleep(time.Millisecond * 300)
+	t.Log("rtt:", caller.RTT())
+	std.Assert(caller.RTT() > 0, "rtt should be measured")
+	select {
+	case <-caller.CloseSignal():
+		t.Fatal("alive peer should not be closed")
+	default:
+	}
+}
+
+func TestHeartbeatDeadPeer(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	core, err := rpcx.New()
+	std.AssertError(err, "new rpc")
+	defer std.CloseIgnoreErr(core)
+	core.Start(ctx)
+	fds, err := liblpc.MakeIpcSockpair(true)
+	std.AssertError(err, "new sock pair")
+	// nobody reads fds[0], peer is dead but connection still open
+	defer syscall.Close(fds[0])
+	caller := rpcx.NewConnStreamCallable(core, fds[1], nil)
+	caller.SetHeartbeat(time.Millisecond*50, 2)
+	caller.Start()
+
+	begin := time.Now()
+	err = caller.Call(time.Second*10, "anything")
+	t.Log("call err:", err, ",cost:", time.Since(begin))
+	std.Assert(err == rpcx.ErrHeartbeatTimeout, "should fail with ErrHeartbeatTimeout")
+	std.Assert(time.Since(begin) < time.Second, "dead peer should be detected soon")
+}
@@ -0,0 +1,192 @@
+package examples
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/gen-iot/liblpc/v2"
+	"github.com/gen-iot/rpcx/v2"
+	"github.com/gen-iot/std"
+	"os"
+	"testing"
+	"time"
+)
+
+func newJsonRpcCore(ctx context.Context) rpcx.Core {
+	core, err := rpcx.New()
+	std.AssertError(err, "new rpc")
+	core.RegFuncWithName("getProp", func(ctx rpcx.Context, name string) (string, error) {
+		if name == "missing" {
+			return "", rpcx.NewError(rpcx.CodeUserDefined+2, "no such prop").WithDetail("prop", name)
+		}
+		return "value of " + name, nil
+	})
+	core.RegFuncWithName("sum", func(ctx rpcx.Context, nums []int) (int, error) {
+		sum := 0
+		for _, n := range nums {
+			sum += n
+		}
+		return sum, nil
+	})
+	core.RegFuncWithName("add", func(ctx context.Context, a, b int) int {
+		return a + b
+	})
+	core.Start(ctx)
+	return core
+}
+
+func TestJsonRpcServe(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	core := newJsonRpcCore(ctx)
+	defer std.CloseIgnoreErr(core)
+	fds, err := liblpc.MakeIpcSockpair(true)
+	std.AssertError(err, "new sock pair")
+	callee := rpcx.NewConnStreamCallable(core, fds[0], nil)
+	callee.SetJsonRpc(rpcx.JsonRpcNewline)
+	callee.Start()
+	defer std.CloseIgnoreErr(callee)
+	client := os.NewFile(uintptr(fds[1]), "jsonrpc-client")
+	defer std.CloseIgnoreErr(client)
+	reader := bufio.NewReader(client)
+
+	roundTrip := func(req string, rsp interface{}) {
+		_, err := client.Write([]byte(req + "\n"))
+		std.AssertError(err, "write request")
+		std.AssertError(client.SetReadDeadline(time.Now().Add(time.Second*3)), "set deadline")
+		line, err := reader.ReadBytes('\n')
+		std.AssertError(err, "read response")
+		t.Log(req, "->", string(line))
+		std.AssertError(json.Unmarshal(line, rsp), "unmarshal response")
+	}
+	type response struct {
+		Version string          `json:"jsonrpc"`
+		Id      json.RawMessage `json:"id"`
+		Result  json.RawMessage `json:"result"`
+		Error   *struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+
+	rsp := new(response)
+	roundTrip(`{"jsonrpc":"2.0","method":"getProp","params":["temp"],"id":1}`, rsp)
+	std.Assert(rsp.Version == "2.0" && string(rsp.Id) == "1", "id mismatched")
+	std.Assert(string(rsp.Result) == `"value of temp"`, "result mismatched")
+
+	rsp = new(response)
+	roundTrip(`{"jsonrpc":"2.0","method":"sum","params":[[1,2,3]],"id":"s"}`, rsp)
+	std.Assert(string(rsp.Id) == `"s"` && string(rsp.Result) == "6", "sum mismatched")
+
+	rsp = new(response)
+	roundTrip(`{"jsonrpc":"2.0","method":"add","params":[1,2],"id":5}`, rsp)
+	std.Assert(string(rsp.Result) == "3", "positional params mismatched")
+
+	// notification never acked, next line answers next request
+	_, err = client.Write([]byte(`{"jsonrpc":"2.0","method":"getProp","params":["temp"]}` + "\n"))
+	std.AssertError(err, "write notification")
+	rsp = new(response)
+	roundTrip(`{"jsonrpc":"2.0","method":"notExist","id":"a"}`, rsp)
+	std.Assert(string(rsp.Id) == `"a"` && rsp.Error != nil && rsp.Error.Code == -32601, "method not found expected")
+
+	rsp = new(response)
+	roundTrip(`{"jsonrpc":"2.0","method":"sum","params":{"a":1},"id":2}`, rsp)
+	std.Assert(rsp.Error != nil && rsp.Error.Code == -32602, "invalid params expected")
+
+	rsp = new(response)
+	roundTrip(`{"jsonrpc":"2.0","method":`, rsp)
+	std.Assert(string(rsp.Id) == "null" && rsp.Error != nil && rsp.Error.Code == -32700, "parse error expected")
+
+	rsps := make([]*response, 0)
+	roundTrip(`[{"jsonrpc":"2.0","method":"getProp","params":["humi"],"id":3},`+
+		`{"jsonrpc":"2.0","method":"getProp","params":["humi"]},`+
+		`{"foo":"bar"},`+
+		`{"jsonrpc":"2.0","method":"getProp","params":["missing"],"id":4}]`, &rsps)
+	std.Assert(len(rsps) == 3, "notification in batch should not be answered")
+	std.Assert(string(rsps[0].Id) == "3" && string(rsps[0].Result) == `"value of humi"`, "batch result mismatched")
+	std.Assert(rsps[1].Error != nil && rsps[1].Error.Code == -32600, "invalid request expected")
+	std.Assert(string(rsps[2].Id) == "4" && rsps[2].Error != nil && rsps[2].Error.Message == "no such prop",
+		"batch error mismatched")
+}
+
+func TestJsonRpcCallable(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	core := newJsonRpcCore(ctx)
+	defer std.CloseIgnoreErr(core)
+	fds, err := liblpc.MakeIpcSockpair(true)
+	std.AssertError(err, "new sock pair")
+	callee := rpcx.NewConnStreamCallable(core, fds[0], nil)
+	callee.SetJsonRpc(rpcx.JsonRpcContentLength)
+	callee.Start()
+	defer std.CloseIgnoreErr(callee)
+	caller := rpcx.NewConnStreamCallable(core, fds[1], nil)
+	caller.SetJsonRpc(rpcx.JsonRpcContentLength)
+	caller.Start()
+	defer std.CloseIgnoreErr(caller)
+
+	out := ""
+	err = caller.Call5(time.Second*3, "getProp", "temp", &out)
+	std.AssertError(err, "call getProp")
+	std.Assert(out == "value of temp", "out mismatched")
+	sum := 0
+	err = caller.Call5(time.Second*3, "sum", []int{1, 2, 3, 4}, &sum)
+	std.AssertError(err, "call sum")
+	std.Assert(sum == 10, "sum mismatched")
+	err = caller.Call5(time.Second*3, "add", rpcx.Args{1, 2}, &sum)
+	std.AssertError(err, "call add")
+	std.Assert(sum == 3, "Args should be sent as positional params")
+	err = caller.Call5(time.Second*3, "getProp", "missing", &out)
+	rpcErr := rpcx.AsError(err)
+	std.Assert(rpcErr != nil && rpcErr.Code == rpcx.CodeUserDefined+2, "error code should be kept")
+	std.Assert(rpcErr.Details["prop"] == "missing", "error details should be kept")
+	err = caller.Call(time.Second*3, "notExist")
+	std.Assert(errors.Is(err, rpcx.ErrFuncNotFound), "func not found expected")
+	std.AssertError(caller.Notify("getProp", nil, "temp"), "notify")
+}
+
+func TestJsonRpcSpoofedResponse(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	core := newJsonRpcCore(ctx)
+	defer std.CloseIgnoreErr(core)
+	newJsonRpcPeer := func() (rpcx.Callable, *os.File) {
+		fds, err := liblpc.MakeIpcSockpair(true)
+		std.AssertError(err, "new sock pair")
+		call := rpcx.NewConnStreamCallable(core, fds[0], nil)
+		call.SetJsonRpc(rpcx.JsonRpcNewline)
+		call.Start()
+		return call, os.NewFile(uintptr(fds[1]), "jsonrpc-peer")
+	}
+	caller, peer := newJsonRpcPeer()
+	defer std.CloseIgnoreErr(caller)
+	defer std.CloseIgnoreErr(peer)
+	other, attacker := newJsonRpcPeer()
+	defer std.CloseIgnoreErr(other)
+	defer std.CloseIgnoreErr(attacker)
+
+	out := ""
+	future := caller.CallAsync(time.Second*3, "getProp", nil, "temp", &out)
+	std.AssertError(peer.SetReadDeadline(time.Now().Add(time.Second*3)), "set deadline")
+	line, err := bufio.NewReader(peer).ReadBytes('\n')
+	std.AssertError(err, "read request")
+	req := &struct {
+		Id json.RawMessage `json:"id"`
+	}{}
+	std.AssertError(json.Unmarshal(line, req), "unmarshal request")
+
+	// response with guessed id from another connection must not complete the call
+	_, err = attacker.Write([]byte(`{"jsonrpc":"2.0","result":"spoofed","id":` + string(req.Id) + "}\n"))
+	std.AssertError(err, "write spoofed response")
+	select {
+	case <-future.Done():
+		t.Fatal("spoofed response accepted")
+	case <-time.After(time.Millisecond * 200):
+	}
+	_, err = peer.Write([]byte(`{"jsonrpc":"2.0","result":"value of temp","id":` + string(req.Id) + "}\n"))
+	std.AssertError(err, "write response")
+	_, err = future.Wait()
+	std.AssertError(err, "call getProp")
+	std.Assert(out == "value of temp", "out mismatched")
+}
@@ -0,0 +1,76 @@
+package examples
+
+import (
+	"context"
+	"errors"
+	"github.com/gen-iot/liblpc/v2"
+	"github.com/gen-iot/rpcx/v2"
+	"github.com/gen-iot/std"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLargeMsg(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	core1, err := rpcx.New()
+	std.AssertError(err, "new rpc")
+	defer std.CloseIgnoreErr(core1)
+	core1.SetMaxMsgSize(1024 * 1536)
+	core1.RegFuncWithName("echo", func(ctx rpcx.Context, in string) (string, error) {
+		return in, nil
+	})
+	core1.Start(ctx)
+	core2, err := rpcx.New()
+	std.AssertError(err, "new rpc")
+	defer std.CloseIgnoreErr(core2)
+	core2.SetMaxMsgSize(1024 * 1024 * 2)
+	core2.Start(ctx)
+
+	fds, err := liblpc.MakeIpcSockpair(true)
+	std.AssertError(err, "new sock pair")
+	// fragments sent only if peer announced it during handshake
+	callee := rpcx.NewSignalCallable(rpcx.NewConnStreamCallable(core1, fds[0], nil))
+	callee.SetHandshake(&rpcx.HandshakeOptions{PeerId: "callee"})
+	callee.Start()
+	caller := rpcx.NewSignalCallable(rpcx.NewConnStreamCallable(core2, fds[1], nil))
+	caller.SetHandshake(&rpcx.HandshakeOptions{PeerId: "caller"})
+	caller.Start()
+	std.AssertError(waitReady(caller), "caller handshake")
+	std.Assert(caller.Peer().MaxMsgSize == 1024*1536, "callee should announce max msg size")
+
+	// fragmented
+	in := strings.Repeat("rpcx", 1024*256)
+	out := new(string)
+	err = caller.Call5(time.Second*30, "echo", in, out)
+	std.AssertError(err, "call echo 1MB")
+	std.Assert(*out == in, "echo mismatched")
+
+	// exceed callee max msg size
+	in = strings.Repeat("rpcx", 1024*448)
+	err = caller.Call5(time.Second*30, "echo", in, out)
+	std.Assert(errors.Is(err, rpcx.ErrMsgTooLarge), "callee should reject")
+
+	// exceed caller max msg size
+	in = strings.Repeat("rpcx", 1024*768)
+	err = caller.Call5(time.Second*30, "echo", in, out)
+	std.Assert(err == rpcx.ErrMsgTooLarge, "caller should reject")
+
+	// single frame limited by callee max msg size if fragment not supported
+	core3, err := rpcx.New()
+	std.AssertError(err, "new rpc")
+	defer std.CloseIgnoreErr(core3)
+	core3.SetMaxMsgSize(1024 * 1024 * 2)
+	core3.Start(ctx)
+	fds, err = liblpc.MakeIpcSockpair(true)
+	std.AssertError(err, "new sock pair")
+	plainCallee := rpcx.NewConnStreamCallable(core1, fds[0], nil)
+	plainCallee.Start()
+	plainCaller := rpcx.NewConnStreamCallable(core3, fds[1], nil)
+	plainCaller.Start()
+	in = strings.Repeat("rpcx", 1024*16)
+	err = plainCaller.Call5(time.Second*30, "echo", in, out)
+	std.AssertError(err, "call echo 64KB without fragment")
+	std.Assert(*out == in, "echo mismatched")
+}
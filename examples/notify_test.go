@@ -0,0 +1,44 @@
+package examples
+
+import (
+	"context"
+	"github.com/gen-iot/liblpc/v2"
+	"github.com/gen-iot/rpcx/v2"
+	"github.com/gen-iot/std"
+	"testing"
+	"time"
+)
+
+type telemetry struct {
+	DeviceId string `json:"deviceId"`
+	Temp     int    `json:"temp"`
+}
+
+func TestNotify(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	core, err := rpcx.New()
+	std.AssertError(err, "new rpc")
+	defer std.CloseIgnoreErr(core)
+	received := make(chan *telemetry, 1)
+	core.RegFuncWithName("report", func(ctx rpcx.Context, in *telemetry) error {
+		received <- in
+		return nil
+	})
+	core.Start(ctx)
+	fds, err := liblpc.MakeIpcSockpair(true)
+	std.AssertError(err, "new sock pair")
+	callee := rpcx.NewConnStreamCallable(core, fds[0], nil)
+	callee.Start()
+	caller := rpcx.NewConnStreamCallable(core, fds[1], nil)
+	caller.Start()
+
+	err = caller.Notify("report", nil, &telemetry{DeviceId: "dev1", Temp: 26})
+	std.AssertError(err, "notify")
+	select {
+	case in := <-received:
+		std.Assert(in.DeviceId == "dev1" && in.Temp == 26, "telemetry mismatched")
+	case <-time.After(time.Second * 5):
+		std.Assert(false, "notify not received")
+	}
+}
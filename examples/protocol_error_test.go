@@ -0,0 +1,76 @@
+package examples
+
+import (
+	"context"
+	"errors"
+	"github.com/gen-iot/liblpc/v2"
+	"github.com/gen-iot/rpcx/v2"
+	"github.com/gen-iot/std"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestProtocolErrorClose(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	core, err := rpcx.New()
+	std.AssertError(err, "new rpc")
+	defer std.CloseIgnoreErr(core)
+	core.Start(ctx)
+	fds, err := liblpc.MakeIpcSockpair(true)
+	std.AssertError(err, "new sock pair")
+	defer syscall.Close(fds[0])
+	caller := rpcx.NewConnStreamCallable(core, fds[1], nil)
+	reported := int32(0)
+	caller.SetOnProtocolError(func(callable rpcx.Callable, err *rpcx.ProtocolError) {
+		t.Log("protocol error:", err)
+		atomic.AddInt32(&reported, 1)
+	})
+	caller.SetMaxProtocolErrors(2)
+	caller.Start()
+
+	time.AfterFunc(time.Millisecond*100, func() {
+		// garbage then frames with broken body, the last one should never be decoded
+		_, _ = syscall.Write(fds[0], []byte{0x01, 0x02, 0x03,
+			0xFE, 0xFE, 0x00, 0x00, 0x00, 0x01, 0xC1,
+			0xFE, 0xFE, 0x00, 0x00, 0x00, 0x01, 0xC1})
+	})
+	begin := time.Now()
+	err = caller.Call(time.Second*10, "anything")
+	t.Log("call err:", err, ",cost:", time.Since(begin))
+	std.Assert(errors.Is(err, rpcx.ErrProtocol), "should fail with protocol error")
+	std.Assert(time.Since(begin) < time.Second, "should fail immediately")
+	std.Assert(caller.ProtocolErrors() == 2, "protocol errors count mismatched")
+	std.Assert(atomic.LoadInt32(&reported) == 2, "callback should be invoked for each bad frame")
+	time.Sleep(time.Millisecond * 100)
+	std.Assert(caller.ProtocolErrors() == 2, "decoding should stop after max protocol errors")
+}
+
+func TestProtocolErrorFrameTooLarge(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	core, err := rpcx.New()
+	std.AssertError(err, "new rpc")
+	defer std.CloseIgnoreErr(core)
+	core.Start(ctx)
+	fds, err := liblpc.MakeIpcSockpair(true)
+	std.AssertError(err, "new sock pair")
+	defer syscall.Close(fds[0])
+	caller := rpcx.NewConnStreamCallable(core, fds[1], nil)
+	kind := make(chan rpcx.ProtocolErrorKind, 1)
+	caller.SetOnProtocolError(func(callable rpcx.Callable, err *rpcx.ProtocolError) {
+		kind <- err.Kind
+	})
+	caller.Start()
+	defer std.CloseIgnoreErr(caller)
+	// 33MB frame is below default max msg size, but exceeds single frame limit
+	_, _ = syscall.Write(fds[0], []byte{0xFE, 0xFE, 0x02, 0x10, 0x00, 0x00})
+	select {
+	case k := <-kind:
+		std.Assert(k == rpcx.ProtoErrFrameTooLarge, "frame too large expected")
+	case <-time.After(time.Second * 3):
+		std.Assert(false, "oversized frame should be rejected at header")
+	}
+}
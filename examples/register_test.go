@@ -0,0 +1,90 @@
+package examples
+
+import (
+	"context"
+	"errors"
+	"github.com/gen-iot/liblpc/v2"
+	"github.com/gen-iot/rpcx/v2"
+	"github.com/gen-iot/std"
+	"testing"
+	"time"
+)
+
+func TestRegisterSignatureError(t *testing.T) {
+	core, err := rpcx.New()
+	std.AssertError(err, "new rpc")
+	cases := []struct {
+		f     interface{}
+		param string
+	}{
+		{func(name string) error { return nil }, "in[0]"},
+		{func(ctx rpcx.Context, names ...string) error { return nil }, "in[1]"},
+		{func(ctx rpcx.Context) (string, int) { return "", 0 }, "out[1]"},
+		{"not a func", ""},
+	}
+	for _, it := range cases {
+		err := core.Register("bad", it.f)
+		t.Log(err)
+		std.Assert(errors.Is(err, rpcx.ErrInvalidSignature), "invalid signature expected")
+		sigErr := new(rpcx.SignatureError)
+		std.Assert(errors.As(err, &sigErr) && sigErr.Func == "bad" && sigErr.Param == it.param, "wrong param reported")
+	}
+}
+
+func TestRegFuncWithNameLegacy(t *testing.T) {
+	core, err := rpcx.New()
+	std.AssertError(err, "new rpc")
+	hello := func(ctx rpcx.Context) error { return nil }
+	core.RegFuncWithName("hello", hello)
+	// legacy api overwrites silently
+	core.RegFuncWithName("hello", func(ctx rpcx.Context) (string, error) { return "v2", nil })
+	methods := core.Describe()
+	std.Assert(len(methods) == 1 && methods[0].Result != nil, "hello should be overwritten")
+	var r interface{} = nil
+	func() {
+		defer func() {
+			r = recover()
+		}()
+		core.RegFuncWithName("bad", func(name string) error { return nil })
+	}()
+	t.Log(r)
+	std.Assert(r != nil, "bad signature should panic")
+	std.Assert(errors.Is(core.Register("hello", hello), rpcx.ErrDuplicateFunc), "Register never overwrites")
+}
+
+func TestRegisterReplace(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	core, err := rpcx.New()
+	std.AssertError(err, "new rpc")
+	defer std.CloseIgnoreErr(core)
+	version := func(v string) func(ctx rpcx.Context) (string, error) {
+		return func(ctx rpcx.Context) (string, error) {
+			return v, nil
+		}
+	}
+	std.AssertError(core.Register("version", version("v1")), "register")
+	err = core.Register("version", version("v1"))
+	std.Assert(errors.Is(err, rpcx.ErrDuplicateFunc), "duplicate func expected")
+	core.Start(ctx)
+	fds, err := liblpc.MakeIpcSockpair(true)
+	std.AssertError(err, "new sock pair")
+	callee := rpcx.NewConnStreamCallable(core, fds[0], nil)
+	callee.Start()
+	defer std.CloseIgnoreErr(callee)
+	caller := rpcx.NewConnStreamCallable(core, fds[1], nil)
+	caller.Start()
+	defer std.CloseIgnoreErr(caller)
+
+	out := ""
+	std.AssertError(caller.Call3(time.Second*3, "version", &out), "call v1")
+	std.Assert(out == "v1", "v1 expected")
+	std.AssertError(core.Replace("version", version("v2")), "replace")
+	std.AssertError(caller.Call3(time.Second*3, "version", &out), "call v2")
+	std.Assert(out == "v2", "v2 expected")
+	std.AssertError(core.Unregister("version"), "unregister")
+	err = caller.Call3(time.Second*3, "version", &out)
+	std.Assert(errors.Is(err, rpcx.ErrFuncNotFound), "func not found expected")
+	std.Assert(errors.Is(core.Unregister("version"), rpcx.ErrFuncNotFound), "unregister twice should fail")
+	std.Assert(errors.Is(core.Replace("version", version("v3")), rpcx.ErrFuncNotFound), "replace missing should fail")
+}
@@ -0,0 +1,55 @@
+package examples
+
+import (
+	"context"
+	"fmt"
+	"github.com/gen-iot/liblpc/v2"
+	"github.com/gen-iot/rpcx/v2"
+	"github.com/gen-iot/std"
+	"testing"
+	"time"
+)
+
+func TestServer(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	core, err := rpcx.New()
+	std.AssertError(err, "new rpc")
+	defer std.CloseIgnoreErr(core)
+	core.RegFuncWithName("hello", func(ctx rpcx.Context) (string, error) {
+		return "hello world", nil
+	})
+	connected := make(chan rpcx.Callable, 1)
+	disconnected := make(chan rpcx.Callable, 1)
+	const addr = "127.0.0.1:18850"
+	opts := rpcx.DefaultServerOptions()
+	opts.OnConnect = func(callable rpcx.Callable, err error) {
+		connected <- callable
+	}
+	opts.OnDisconnect = func(callable rpcx.Callable, err error) {
+		disconnected <- callable
+	}
+	srv, err := rpcx.Listen(core, addr, opts)
+	std.AssertError(err, "listen")
+	core.Start(ctx)
+
+	sockAddr, err := liblpc.ResolveTcpAddr(addr)
+	std.AssertError(err, "resolve addr")
+	call, err := rpcx.NewClientStreamCallable(core, sockAddr, nil)
+	std.AssertError(err, "new client callable")
+	callable := rpcx.NewSignalCallable(call)
+	callable.Start()
+	std.AssertError(<-callable.ReadySignal(), "client ready")
+	<-connected
+	std.Assert(srv.Len() == 1, "server should own 1 callable")
+
+	out := new(string)
+	err = callable.Call3(time.Second*5, "hello", out)
+	std.AssertError(err, "call hello")
+	fmt.Println("remote ack:", *out)
+
+	std.AssertError(srv.Close(), "close server")
+	<-disconnected
+	<-callable.CloseSignal()
+	std.Assert(srv.Len() == 0, "server should own nothing after close")
+}
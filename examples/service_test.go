@@ -0,0 +1,72 @@
+package examples
+
+import (
+	"context"
+	"github.com/gen-iot/liblpc/v2"
+	"github.com/gen-iot/rpcx/v2"
+	"github.com/gen-iot/std"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type deviceService struct {
+	props map[string]string
+}
+
+func (this *deviceService) GetProp(ctx rpcx.Context, name string) (string, error) {
+	return this.props[name], nil
+}
+
+func (this *deviceService) SetProp(ctx rpcx.Context, prop map[string]string) error {
+	for k, v := range prop {
+		this.props[k] = v
+	}
+	return nil
+}
+
+// not rpc signature, skipped
+func (this *deviceService) Len() int {
+	return len(this.props)
+}
+
+func TestRegService(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	core, err := rpcx.New()
+	std.AssertError(err, "new rpc")
+	defer std.CloseIgnoreErr(core)
+	invoked := int32(0)
+	report := core.RegService("Device", &deviceService{props: map[string]string{"temp": "26"}},
+		func(next rpcx.HandleFunc) rpcx.HandleFunc {
+			return func(ctx rpcx.Context) {
+				atomic.AddInt32(&invoked, 1)
+				next(ctx)
+			}
+		})
+	t.Log(report)
+	std.Assert(len(report.Registered) == 2, "2 methods should be registered")
+	std.Assert(len(report.Skipped) == 1 && report.Skipped[0].Name == "Len", "Len should be skipped")
+	std.Assert(!strings.HasPrefix(report.Skipped[0].Reason, ":"), "empty param should not be prefixed")
+	// registered methods never overwritten
+	again := core.RegService("Device", &deviceService{})
+	std.Assert(len(again.Registered) == 0 && len(again.Skipped) == 3, "duplicated methods should be skipped")
+	core.Start(ctx)
+	fds, err := liblpc.MakeIpcSockpair(true)
+	std.AssertError(err, "new sock pair")
+	callee := rpcx.NewConnStreamCallable(core, fds[0], nil)
+	callee.Start()
+	defer std.CloseIgnoreErr(callee)
+	caller := rpcx.NewConnStreamCallable(core, fds[1], nil)
+	caller.Start()
+	defer std.CloseIgnoreErr(caller)
+
+	err = caller.Call1(time.Second*3, "Device.SetProp", map[string]string{"humi": "60"})
+	std.AssertError(err, "call SetProp")
+	out := ""
+	err = caller.Call5(time.Second*3, "Device.GetProp", "humi", &out)
+	std.AssertError(err, "call GetProp")
+	std.Assert(out == "60", "prop mismatched")
+	std.Assert(atomic.LoadInt32(&invoked) == 2, "service middleware should be applied")
+}
@@ -0,0 +1,74 @@
+package examples
+
+import (
+	"context"
+	"errors"
+	"github.com/gen-iot/liblpc/v2"
+	"github.com/gen-iot/rpcx/v2"
+	"github.com/gen-iot/std"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type greeting struct {
+	Name  string `json:"name"`
+	Times int    `json:"times"`
+}
+
+func TestRichSignatures(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	core, err := rpcx.New()
+	std.AssertError(err, "new rpc")
+	defer std.CloseIgnoreErr(core)
+	touched := int32(0)
+	// no error returned
+	core.RegFuncWithName("add", func(ctx context.Context, a, b int) int {
+		return a + b
+	})
+	core.RegFuncWithName("greet", func(ctx rpcx.Context, g *greeting, sep string, upper bool) (string, error) {
+		out := strings.TrimSuffix(strings.Repeat("hello "+g.Name+sep, g.Times), sep)
+		if upper {
+			out = strings.ToUpper(out)
+		}
+		return out, nil
+	})
+	core.RegFuncWithName("deadline", func(ctx context.Context) error {
+		if _, ok := ctx.Deadline(); !ok {
+			return errors.New("deadline of caller not passed")
+		}
+		return nil
+	})
+	core.RegFuncWithName("touch", func(ctx rpcx.Context) {
+		atomic.AddInt32(&touched, 1)
+	})
+	core.Start(ctx)
+	fds, err := liblpc.MakeIpcSockpair(true)
+	std.AssertError(err, "new sock pair")
+	callee := rpcx.NewConnStreamCallable(core, fds[0], nil)
+	callee.Start()
+	defer std.CloseIgnoreErr(callee)
+	caller := rpcx.NewConnStreamCallable(core, fds[1], nil)
+	caller.Start()
+	defer std.CloseIgnoreErr(caller)
+
+	for _, codec := range []rpcx.Codec{rpcx.MsgPackCodec, rpcx.JsonCodec} {
+		core.SetCodec(codec)
+		sum := 0
+		err = caller.Call5(time.Second*3, "add", rpcx.Args{1, 2}, &sum)
+		std.AssertError(err, "call add")
+		std.Assert(sum == 3, "sum mismatched")
+		out := ""
+		err = caller.Call5(time.Second*3, "greet", rpcx.Args{&greeting{Name: "rpcx", Times: 2}, ",", true}, &out)
+		std.AssertError(err, "call greet")
+		std.Assert(out == "HELLO RPCX,HELLO RPCX", "greet mismatched")
+		err = caller.Call5(time.Second*3, "add", rpcx.Args{1}, &sum)
+		t.Log(codec.Name(), "params count mismatched:", err)
+		std.Assert(errors.Is(err, rpcx.ErrInvalidParams), "invalid params expected")
+		std.AssertError(caller.Call(time.Second*3, "deadline"), "call deadline")
+		std.AssertError(caller.Call(time.Second*3, "touch"), "call touch")
+	}
+	std.Assert(atomic.LoadInt32(&touched) == 2, "touch should be invoked")
+}
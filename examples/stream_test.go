@@ -0,0 +1,119 @@
+package examples
+
+import (
+	"context"
+	"github.com/gen-iot/liblpc/v2"
+	"github.com/gen-iot/rpcx/v2"
+	"github.com/gen-iot/std"
+	"io"
+	"testing"
+	"time"
+)
+
+// count > rpcx.StreamWindow, exercise flow control
+const streamMsgCount = rpcx.StreamWindow * 4
+
+func streamCount(ctx rpcx.Context, stream rpcx.Stream) error {
+	for i := 0; i < streamMsgCount; i++ {
+		if err := stream.Send(i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func streamSum(ctx rpcx.Context, stream rpcx.Stream) (int, error) {
+	sum := 0
+	for {
+		v := 0
+		err := stream.Recv(&v)
+		if err == io.EOF {
+			return sum, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		sum += v
+	}
+}
+
+func streamEcho(ctx rpcx.Context, stream rpcx.Stream) error {
+	for {
+		v := ""
+		err := stream.Recv(&v)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err = stream.Send(v); err != nil {
+			return err
+		}
+	}
+}
+
+func TestStream(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	core, err := rpcx.New()
+	std.AssertError(err, "new rpc")
+	defer std.CloseIgnoreErr(core)
+	core.RegFunc(streamCount)
+	core.RegFunc(streamSum)
+	core.RegFunc(streamEcho)
+	core.Start(ctx)
+	fds, err := liblpc.MakeIpcSockpair(true)
+	std.AssertError(err, "new sock pair")
+	callee := rpcx.NewConnStreamCallable(core, fds[0], nil)
+	callee.Start()
+	caller := rpcx.NewConnStreamCallable(core, fds[1], nil)
+	caller.Start()
+
+	callCtx, callCancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer callCancel()
+
+	// server stream
+	stream, err := caller.OpenStream(callCtx, "streamCount", nil)
+	std.AssertError(err, "open streamCount")
+	std.AssertError(stream.CloseSend(), "close send")
+	count := 0
+	for {
+		v := 0
+		err = stream.Recv(&v)
+		if err == io.EOF {
+			break
+		}
+		std.AssertError(err, "recv count")
+		std.Assert(v == count, "count mismatched")
+		count++
+	}
+	std.Assert(count == streamMsgCount, "count mismatched")
+
+	// client stream
+	stream, err = caller.OpenStream(callCtx, "streamSum", nil)
+	std.AssertError(err, "open streamSum")
+	expect := 0
+	for i := 0; i < streamMsgCount; i++ {
+		std.AssertError(stream.Send(i), "send")
+		expect += i
+	}
+	std.AssertError(stream.CloseSend(), "close send")
+	err = stream.Recv(nil)
+	std.Assert(err == io.EOF, "callee should finish stream")
+	sum := 0
+	std.AssertError(stream.BindAck(&sum), "bind ack")
+	std.Assert(sum == expect, "sum mismatched")
+
+	// bidirectional stream
+	stream, err = caller.OpenStream(callCtx, "streamEcho", nil)
+	std.AssertError(err, "open streamEcho")
+	for _, word := range []string{"hello", "stream", "world"} {
+		std.AssertError(stream.Send(word), "send")
+		echo := ""
+		std.AssertError(stream.Recv(&echo), "recv")
+		std.Assert(echo == word, "echo mismatched")
+	}
+	std.AssertError(stream.CloseSend(), "close send")
+	std.Assert(stream.Recv(nil) == io.EOF, "callee should finish stream")
+}
@@ -0,0 +1,25 @@
+package examples
+
+import (
+	"context"
+	"github.com/gen-iot/rpcx/v2"
+)
+
+//go:generate go run ../cmd/rpcxgen -type Thermostat
+
+type SetPointReq struct {
+	Zone    string  `json:"zone" validate:"required"`
+	Celsius float64 `json:"celsius"`
+}
+
+type SetPointRsp struct {
+	Previous float64 `json:"previous"`
+}
+
+// handlers of thermostat, typed client and register helper generated by rpcxgen
+type Thermostat interface {
+	SetPoint(ctx rpcx.Context, req *SetPointReq) (*SetPointRsp, error)
+	Temperature(ctx context.Context, zone string) (float64, error)
+	Move(ctx rpcx.Context, from, to string) error
+	Reset(ctx rpcx.Context)
+}
@@ -0,0 +1,78 @@
+// Code generated by rpcxgen. DO NOT EDIT.
+
+package examples
+
+import (
+	"github.com/gen-iot/rpcx/v2"
+	"time"
+)
+
+// methods of Thermostat
+const (
+	ThermostatSetPoint    = "Thermostat.SetPoint"
+	ThermostatTemperature = "Thermostat.Temperature"
+	ThermostatMove        = "Thermostat.Move"
+	ThermostatReset       = "Thermostat.Reset"
+)
+
+// register methods of impl with the names used by ThermostatClient,
+// registered ones are rolled back if any failed
+func RegisterThermostat(core rpcx.Core, impl Thermostat, m ...rpcx.MiddlewareFunc) error {
+	handlers := []struct {
+		name string
+		fn   interface{}
+	}{
+		{ThermostatSetPoint, impl.SetPoint},
+		{ThermostatTemperature, impl.Temperature},
+		{ThermostatMove, impl.Move},
+		{ThermostatReset, impl.Reset},
+	}
+	for idx, it := range handlers {
+		if err := core.Register(it.name, it.fn, m...); err != nil {
+			for _, registered := range handlers[:idx] {
+				_ = core.Unregister(registered.name)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// typed client of Thermostat, calls performed by Callable.Call6
+type ThermostatClient struct {
+	Callable rpcx.Callable
+	Timeout  time.Duration
+}
+
+func NewThermostatClient(callable rpcx.Callable, timeout time.Duration) *ThermostatClient {
+	return &ThermostatClient{
+		Callable: callable,
+		Timeout:  timeout,
+	}
+}
+
+func (this *ThermostatClient) SetPoint(headers rpcx.RpcMsgHeader, req *SetPointReq, mids ...rpcx.MiddlewareFunc) (out *SetPointRsp, ackHeader rpcx.RpcMsgHeader, err error) {
+	rsp := new(SetPointRsp)
+	ackHeader, err = this.Callable.Call6(this.Timeout, ThermostatSetPoint, headers, req, rsp, mids...)
+	if err == nil {
+		out = rsp
+	}
+	return
+}
+
+func (this *ThermostatClient) Temperature(headers rpcx.RpcMsgHeader, zone string, mids ...rpcx.MiddlewareFunc) (out float64, ackHeader rpcx.RpcMsgHeader, err error) {
+	rsp := new(float64)
+	ackHeader, err = this.Callable.Call6(this.Timeout, ThermostatTemperature, headers, zone, rsp, mids...)
+	if err == nil {
+		out = *rsp
+	}
+	return
+}
+
+func (this *ThermostatClient) Move(headers rpcx.RpcMsgHeader, from string, to string, mids ...rpcx.MiddlewareFunc) (ackHeader rpcx.RpcMsgHeader, err error) {
+	return this.Callable.Call6(this.Timeout, ThermostatMove, headers, rpcx.Args{from, to}, nil, mids...)
+}
+
+func (this *ThermostatClient) Reset(headers rpcx.RpcMsgHeader, mids ...rpcx.MiddlewareFunc) (ackHeader rpcx.RpcMsgHeader, err error) {
+	return this.Callable.Call6(this.Timeout, ThermostatReset, headers, nil, nil, mids...)
+}
@@ -0,0 +1,86 @@
+package examples
+
+import (
+	"context"
+	"errors"
+	"github.com/gen-iot/liblpc/v2"
+	"github.com/gen-iot/rpcx/v2"
+	"github.com/gen-iot/std"
+	"sync"
+	"testing"
+	"time"
+)
+
+type thermostat struct {
+	lock   sync.Mutex
+	points map[string]float64
+}
+
+func (this *thermostat) SetPoint(ctx rpcx.Context, req *SetPointReq) (*SetPointRsp, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	previous := this.points[req.Zone]
+	this.points[req.Zone] = req.Celsius
+	ctx.SetResponseHeader(rpcx.RpcMsgHeader{"zone": req.Zone, "by": ctx.RequestHeader()["user"]})
+	return &SetPointRsp{Previous: previous}, nil
+}
+
+func (this *thermostat) Temperature(ctx context.Context, zone string) (float64, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	celsius, ok := this.points[zone]
+	if !ok {
+		return 0, rpcx.NewError(rpcx.CodeUserDefined+3, "no such zone")
+	}
+	return celsius, nil
+}
+
+func (this *thermostat) Move(ctx rpcx.Context, from, to string) error {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.points[to] = this.points[from]
+	delete(this.points, from)
+	return nil
+}
+
+func (this *thermostat) Reset(ctx rpcx.Context) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.points = map[string]float64{}
+}
+
+func TestGeneratedStub(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	core, err := rpcx.New()
+	std.AssertError(err, "new rpc")
+	defer std.CloseIgnoreErr(core)
+	std.AssertError(RegisterThermostat(core, &thermostat{points: map[string]float64{}}), "register thermostat")
+	err = RegisterThermostat(core, &thermostat{})
+	std.Assert(errors.Is(err, rpcx.ErrDuplicateFunc), "duplicate func expected")
+	core.Start(ctx)
+	fds, err := liblpc.MakeIpcSockpair(true)
+	std.AssertError(err, "new sock pair")
+	callee := rpcx.NewConnStreamCallable(core, fds[0], nil)
+	callee.Start()
+	defer std.CloseIgnoreErr(callee)
+	caller := rpcx.NewConnStreamCallable(core, fds[1], nil)
+	caller.Start()
+	defer std.CloseIgnoreErr(caller)
+	client := NewThermostatClient(caller, time.Second*3)
+
+	rsp, ackHeader, err := client.SetPoint(rpcx.RpcMsgHeader{"user": "admin"}, &SetPointReq{Zone: "living", Celsius: 22.5})
+	std.AssertError(err, "set point")
+	std.Assert(rsp.Previous == 0, "previous mismatched")
+	std.Assert(ackHeader["zone"] == "living" && ackHeader["by"] == "admin", "ack header mismatched")
+	_, err = client.Move(nil, "living", "bedroom")
+	std.AssertError(err, "move")
+	celsius, _, err := client.Temperature(nil, "bedroom")
+	std.AssertError(err, "temperature")
+	std.Assert(celsius == 22.5, "temperature mismatched")
+	_, err = client.Reset(nil)
+	std.AssertError(err, "reset")
+	_, _, err = client.Temperature(nil, "bedroom")
+	rpcErr := rpcx.AsError(err)
+	std.Assert(rpcErr != nil && rpcErr.Code == rpcx.CodeUserDefined+3, "no such zone expected")
+}
@@ -0,0 +1,198 @@
+package examples
+
+import (
+	"context"
+	"errors"
+	"github.com/gen-iot/liblpc/v2"
+	"github.com/gen-iot/rpcx/v2"
+	"github.com/gen-iot/std"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newPoolPair(core rpcx.Core) (callee, caller rpcx.Callable) {
+	fds, err := liblpc.MakeIpcSockpair(true)
+	std.AssertError(err, "new sock pair")
+	callee = rpcx.NewConnStreamCallable(core, fds[0], nil)
+	callee.Start()
+	caller = rpcx.NewConnStreamCallable(core, fds[1], nil)
+	caller.Start()
+	return callee, caller
+}
+
+func waitStats(stats func() *rpcx.WorkerPoolStats, cond func(s *rpcx.WorkerPoolStats) bool) *rpcx.WorkerPoolStats {
+	deadline := time.Now().Add(time.Second * 3)
+	for {
+		s := stats()
+		if cond(s) || time.Now().After(deadline) {
+			return s
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+}
+
+func TestWorkerPool(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	core, err := rpcx.New()
+	std.AssertError(err, "new rpc")
+	defer std.CloseIgnoreErr(core)
+	gate := make(chan struct{})
+	core.RegFuncWithName("wait", func(ctx rpcx.Context, n int) (int, error) {
+		<-gate
+		return n, nil
+	})
+	std.Assert(core.WorkerPoolStats() == nil, "pool disabled by default")
+	core.SetWorkerPool(&rpcx.WorkerPoolOptions{Workers: 2, QueueSize: 2, Policy: rpcx.OverloadReject})
+	core.Start(ctx)
+	callee, caller := newPoolPair(core)
+	defer std.CloseIgnoreErr(callee)
+	defer std.CloseIgnoreErr(caller)
+
+	futures := make([]*rpcx.CallFuture, 0)
+	for i := 0; i < 10; i++ {
+		futures = append(futures, caller.CallAsync(time.Second*3, "wait", nil, i, new(int)))
+	}
+	// workers may dequeue while requests arriving, so 2 to 4 accepted
+	stats := waitStats(core.WorkerPoolStats, func(s *rpcx.WorkerPoolStats) bool {
+		return s.Running == 2 && uint64(s.Running+s.Queued)+s.Rejected == 10
+	})
+	t.Logf("%+v", stats)
+	accepted := 10 - int(stats.Rejected)
+	std.Assert(stats.Running == 2 && stats.Running+stats.Queued == accepted && accepted <= 4 && stats.MaxQueued <= 2,
+		"at most 2 running and 2 queued expected")
+	pending := make([]*rpcx.CallFuture, 0)
+	for _, f := range futures {
+		select {
+		case <-f.Done():
+			std.Assert(errors.Is(f.Err(), rpcx.ErrBusy), "busy expected")
+		case <-time.After(time.Millisecond * 100):
+			pending = append(pending, f)
+		}
+	}
+	std.Assert(len(pending) == accepted, "accepted calls should be pending")
+	close(gate)
+	std.AssertError(rpcx.WaitAll(pending...), "accepted calls should succeed")
+	stats = waitStats(core.WorkerPoolStats, func(s *rpcx.WorkerPoolStats) bool {
+		return s.Handled == uint64(accepted)
+	})
+	std.Assert(stats.Handled == uint64(accepted) && stats.Running == 0 && stats.Queued == 0, "all accepted should be handled")
+}
+
+func TestWorkerPoolPolicy(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	core, err := rpcx.New()
+	std.AssertError(err, "new rpc")
+	defer std.CloseIgnoreErr(core)
+	core.RegFuncWithName("sleep", func(ctx rpcx.Context, d time.Duration) error {
+		time.Sleep(d)
+		return nil
+	})
+	core.Start(ctx)
+
+	// callable pool overrides core pool
+	callee, caller := newPoolPair(core)
+	callee.SetWorkerPool(&rpcx.WorkerPoolOptions{Workers: 1, QueueSize: 1, Policy: rpcx.OverloadDrop})
+	futures := make([]*rpcx.CallFuture, 0)
+	for i := 0; i < 4; i++ {
+		futures = append(futures, caller.CallAsync(time.Millisecond*300, "sleep", nil, time.Millisecond*50, nil))
+	}
+	timeouts := 0
+	for _, f := range futures {
+		_, err := f.Wait()
+		if err == std.ErrFutureTimeout {
+			timeouts++
+			continue
+		}
+		std.AssertError(err, "accepted call should succeed")
+	}
+	dropped := callee.WorkerPoolStats().Dropped
+	std.Assert(dropped >= 2 && uint64(timeouts) == dropped, "dropped calls should time out")
+	std.Assert(core.WorkerPoolStats() == nil, "core pool not set")
+	std.CloseIgnoreErr(callee)
+	std.CloseIgnoreErr(caller)
+
+	core.SetWorkerPool(&rpcx.WorkerPoolOptions{Workers: 1, QueueSize: 1, Policy: rpcx.OverloadBlock})
+	callee, caller = newPoolPair(core)
+	defer std.CloseIgnoreErr(callee)
+	defer std.CloseIgnoreErr(caller)
+	futures = futures[:0]
+	for i := 0; i < 4; i++ {
+		futures = append(futures, caller.CallAsync(time.Second*3, "sleep", nil, time.Millisecond*50, nil))
+	}
+	std.AssertError(rpcx.WaitAll(futures...), "blocked calls should succeed")
+	stats := core.WorkerPoolStats()
+	std.Assert(stats.Handled == 4 && stats.Blocked >= 1, "reading should be blocked")
+}
+
+func TestWorkerPoolBatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	core, err := rpcx.New()
+	std.AssertError(err, "new rpc")
+	defer std.CloseIgnoreErr(core)
+	running, peak := int32(0), int32(0)
+	core.RegFuncWithName("track", func(ctx rpcx.Context, n int) (int, error) {
+		cur := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			old := atomic.LoadInt32(&peak)
+			if cur <= old || atomic.CompareAndSwapInt32(&peak, old, cur) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond * 5)
+		return n, nil
+	})
+	core.SetWorkerPool(&rpcx.WorkerPoolOptions{Workers: 2, QueueSize: 2})
+	core.Start(ctx)
+	callee, caller := newPoolPair(core)
+	defer std.CloseIgnoreErr(callee)
+	defer std.CloseIgnoreErr(caller)
+
+	// items of parallel batch run on idle workers, never more than pool allows
+	batch := caller.Batch().SetParallel(true)
+	for i := 0; i < 8; i++ {
+		batch.Add("track", i, new(int))
+	}
+	std.AssertError(batch.Do(time.Second*3), "batch do")
+	stats := waitStats(core.WorkerPoolStats, func(s *rpcx.WorkerPoolStats) bool {
+		return s.Running == 0
+	})
+	t.Logf("%+v peak %d", stats, atomic.LoadInt32(&peak))
+	std.Assert(atomic.LoadInt32(&peak) == 2, "items should run concurrently, bounded by pool")
+	std.Assert(stats.Rejected == 0 && stats.Dropped == 0, "items should never be rejected")
+
+	// item waiting on its sibling won't stall until timeout
+	signal := make(chan struct{})
+	core.RegFuncWithName("wait", func(ctx rpcx.Context) error {
+		select {
+		case <-signal:
+			return nil
+		case <-time.After(time.Second * 2):
+			return errors.New("sibling never ran")
+		}
+	})
+	core.RegFuncWithName("signal", func(ctx rpcx.Context) error {
+		close(signal)
+		return nil
+	})
+	batch = caller.Batch().SetParallel(true)
+	waitCall := batch.Add("wait", nil, nil)
+	signalCall := batch.Add("signal", nil, nil)
+	std.AssertError(batch.Do(time.Second*3), "batch do")
+	std.AssertError(waitCall.Err(), "wait sibling")
+	std.AssertError(signalCall.Err(), "signal sibling")
+}
+
+func TestWorkerPoolVirtualCallableClose(t *testing.T) {
+	core, err := rpcx.New()
+	std.AssertError(err, "new rpc")
+	vCall := rpcx.NewVirtualCallable(core, nil)
+	vCall.SetWorkerPool(&rpcx.WorkerPoolOptions{Workers: 2})
+	std.Assert(vCall.WorkerPoolStats() != nil, "pool of callable should be enabled")
+	std.AssertError(vCall.Close(), "close virtual callable")
+	std.Assert(vCall.WorkerPoolStats() == nil, "pool of callable should be stopped after close")
+}
@@ -1,10 +1,10 @@
 module github.com/gen-iot/rpcx/v2
 
-go 1.12
+go 1.13
 
 require (
 	github.com/gen-iot/liblpc/v2 v2.0.1
-	github.com/gen-iot/log v1.0.3 // indirect
+	github.com/gen-iot/log v1.0.3
 	github.com/gen-iot/std v1.0.12
 	github.com/pkg/errors v0.8.1
 )
@@ -0,0 +1,17 @@
+package middleware
+
+import (
+	"github.com/gen-iot/rpcx/v2"
+	"github.com/gen-iot/std"
+)
+
+// override payload codec of single call, callee ack with the same codec
+func Codec(codec rpcx.Codec) rpcx.MiddlewareFunc {
+	std.Assert(codec != nil, "codec is nil")
+	return func(next rpcx.HandleFunc) rpcx.HandleFunc {
+		return func(ctx rpcx.Context) {
+			ctx.SetCodec(codec)
+			next(ctx)
+		}
+	}
+}
@@ -76,6 +76,10 @@ func (this *Mq) Middleware() rpcx.MiddlewareFunc {
 			fdw.reply = replyTopic
 			fdw.sendF = this.mqSend
 			ctx.SetWriter(fdw)
+			if ctx.Callable() != this.vCall {
+				// caller side, ack comes back through mq
+				ctx.AddDefer(this.vCall.AcceptAck(ctx))
+			}
 			next(ctx)
 		}
 	}
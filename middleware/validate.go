@@ -1,9 +1,9 @@
 package middleware
 
 import (
+	"fmt"
 	"github.com/gen-iot/rpcx/v2"
 	"github.com/gen-iot/std"
-	"github.com/pkg/errors"
 	"reflect"
 )
 
@@ -16,6 +16,13 @@ const (
 	ValidateInOut              = ValidateIn | ValidateOut
 )
 
+// errors.Is(err, rpcx.ErrValidationFailed) == true
+func validationError(err error, stage string) *rpcx.Error {
+	return rpcx.NewError(rpcx.CodeValidationFailed,
+		fmt.Sprintf("validate %s err: %s", stage, err.Error())).
+		WithDetail("stage", stage)
+}
+
 // only validate struct , other values will ignore
 func ValidateStruct(flag ValidateFlag, v std.Validator) rpcx.MiddlewareFunc {
 	std.Assert(v != nil, "validator is nil")
@@ -34,7 +41,7 @@ func ValidateStruct(flag ValidateFlag, v std.Validator) rpcx.MiddlewareFunc {
 					if reqT.Kind() == reflect.Struct {
 						err = v.Validate(ctx.Request())
 						if err != nil {
-							ctx.SetError(errors.Wrap(err, "validate req err"))
+							ctx.SetError(validationError(err, "request"))
 							return
 						}
 					}
@@ -60,7 +67,7 @@ func ValidateStruct(flag ValidateFlag, v std.Validator) rpcx.MiddlewareFunc {
 				}
 				err = v.Validate(ctx.Response())
 				if err != nil {
-					ctx.SetError(errors.Wrap(err, "validate rsp err"))
+					ctx.SetError(validationError(err, "response"))
 					return
 				}
 			}
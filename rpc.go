@@ -7,7 +7,6 @@ import (
 	"github.com/gen-iot/std"
 	"io"
 	"log"
-	"reflect"
 	"sync"
 	"sync/atomic"
 )
@@ -17,8 +16,20 @@ var gRpcSerialization = std.MsgPackSerialization
 
 type Core interface {
 	Loop() *liblpc.IOEvtLoop
+	// legacy, panic if f is bad and overwrite func of same name. use Register instead
 	RegFunc(f interface{}, m ...MiddlewareFunc)
 	RegFuncWithName(fname string, f interface{}, m ...MiddlewareFunc)
+	// register exported methods of receiver as `name.Method`, report tells which were skipped
+	RegService(name string, receiver interface{}, m ...MiddlewareFunc) *ServiceReport
+	// never panic or overwrite, *SignatureError or ErrDuplicateFunc returned
+	Register(fname string, f interface{}, m ...MiddlewareFunc) error
+	RegisterFunc(f interface{}, m ...MiddlewareFunc) error
+	Unregister(fname string) error
+	// swap handler of registered func at runtime
+	Replace(fname string, f interface{}, m ...MiddlewareFunc) error
+	// register reserved DescribeMethod so that peers can explore methods at runtime
+	EnableDescribe(m ...MiddlewareFunc)
+	Describe() []*MethodSchema
 	PreUse(m ...MiddlewareFunc)
 	Use(m ...MiddlewareFunc)
 	BuildChain(h HandleFunc) HandleFunc
@@ -28,6 +39,27 @@ type Core interface {
 	GrabContext() Context
 	ReleaseContext(c Context)
 	PromiseGroup() *std.PromiseGroup
+	// default payload codec of calls issued by this core, msgpack if not set
+	SetCodec(codec Codec)
+	Codec() Codec
+	// max encoded size of single msg, large msg will be sent as fragments
+	SetMaxMsgSize(size int)
+	MaxMsgSize() int
+	// highest framing this core speaks, peers switch to it after negotiated. FramingV3 by default
+	SetFraming(framing int)
+	Framing() int
+	// compress msgs issued by this core if peer supports it, nil disables compression
+	SetCompression(opts *CompressionOptions)
+	// override core compression for method, nil disables compression of method
+	SetMethodCompression(method string, opts *CompressionOptions)
+	Compression(method string) *CompressionOptions
+	// append crc32 to frames if peer supports it
+	SetChecksum(enable bool)
+	Checksum() bool
+	// bound goroutines handling requests, nil disables pool so that each request runs in new goroutine
+	SetWorkerPool(opts *WorkerPoolOptions)
+	// nil if pool disabled
+	WorkerPoolStats() *WorkerPoolStats
 	NotifyCallableRead(call Callable, buf std.ReadableBuffer)
 	io.Closer
 }
@@ -41,6 +73,12 @@ type coreImpl struct {
 	middleware
 	preUseMiddleware middleware
 	ctxPool          sync.Pool
+	codec            Codec
+	maxMsgSize       int
+	framing          int
+	compression      *compressionConfig
+	checksum         int32
+	workers          workerPoolHolder
 }
 
 const RpcLoopDefaultBufferSize = 1024 * 1024 * 4
@@ -56,6 +94,10 @@ func New() (core Core, err error) {
 		promiseGroup: std.NewPromiseGroup(),
 		lock:         &sync.RWMutex{},
 		startFlag:    0,
+		codec:        MsgPackCodec,
+		maxMsgSize:   DefaultMaxMsgSize,
+		framing:      FramingV3,
+		compression:  newCompressionConfig(),
 	}
 	rpc.ctxPool.New = func() interface{} {
 		return new(contextImpl)
@@ -77,6 +119,53 @@ func (this *coreImpl) PromiseGroup() *std.PromiseGroup {
 	return this.promiseGroup
 }
 
+func (this *coreImpl) SetCodec(codec Codec) {
+	std.Assert(codec != nil, "codec is nil")
+	this.codec = codec
+}
+
+func (this *coreImpl) Codec() Codec {
+	return this.codec
+}
+
+func (this *coreImpl) SetMaxMsgSize(size int) {
+	std.Assert(size > 0, "max msg size must > 0")
+	this.maxMsgSize = size
+}
+
+func (this *coreImpl) MaxMsgSize() int {
+	return this.maxMsgSize
+}
+
+// max body len of single frame received, both raw and decompressed
+func (this *coreImpl) maxFrameLen() int {
+	if this.maxMsgSize < kMaxFrameBodyLen {
+		return this.maxMsgSize
+	}
+	return kMaxFrameBodyLen
+}
+
+func (this *coreImpl) SetFraming(framing int) {
+	std.Assert(framing == FramingV2 || framing == FramingV3, "unknown framing")
+	this.framing = framing
+}
+
+func (this *coreImpl) Framing() int {
+	return this.framing
+}
+
+func (this *coreImpl) SetChecksum(enable bool) {
+	var flag int32 = 0
+	if enable {
+		flag = 1
+	}
+	atomic.StoreInt32(&this.checksum, flag)
+}
+
+func (this *coreImpl) Checksum() bool {
+	return atomic.LoadInt32(&this.checksum) != 0
+}
+
 func (this *coreImpl) PreUse(m ...MiddlewareFunc) {
 	this.preUseMiddleware.Use(m...)
 }
@@ -94,40 +183,26 @@ func (this *coreImpl) getFunc(name string) *rpcFunc {
 	return fn
 }
 
+// legacy, panics if f is bad and overwrites func of same name silently.
+// use Register or Replace instead
 func (this *coreImpl) RegFuncWithName(fname string, f interface{}, m ...MiddlewareFunc) {
-	fv, ok := f.(reflect.Value)
-	if !ok {
-		fv = reflect.ValueOf(f)
-	}
-	std.Assert(fv.Kind() == reflect.Func, "f not func!")
-	fvType := fv.Type()
-	//check in/out param
-	inParamType, inParamDesc := checkInParam(fvType)
-	outParamType, outParamDesc := checkOutParam(fvType)
-	//
+	fn, err := this.buildFunc(fname, f, m...)
+	std.AssertError(err, "reg func")
+	this.addFunc(fn)
+}
+
+// overwrites func of same name, used by legacy RegFunc* and EnableDescribe
+func (this *coreImpl) addFunc(fn *rpcFunc) {
 	this.lock.Lock()
 	defer this.lock.Unlock()
-	//
-	fn := &rpcFunc{
-		name:           fname,
-		fun:            fv,
-		inParamType:    inParamType,
-		outParamType:   outParamType,
-		handleFuncDesc: inParamDesc | outParamDesc,
-	}
-	fn.mid.Use(m...)
-	fn.handleFunc = fn.mid.buildChain(fn.____invoke)
-	this.rcpFuncMap[fname] = fn
+	this.rcpFuncMap[fn.name] = fn
 }
 
+// legacy, like RegFuncWithName, name derived from f
 func (this *coreImpl) RegFunc(f interface{}, m ...MiddlewareFunc) {
-	fv, ok := f.(reflect.Value)
-	if !ok {
-		fv = reflect.ValueOf(f)
-	}
-	std.Assert(fv.Kind() == reflect.Func, "f not func!")
-	fname := getFuncName(fv)
-	this.RegFuncWithName(fname, fv, m...)
+	fv, err := funcValueOf("", f)
+	std.AssertError(err, "reg func")
+	this.RegFuncWithName(getFuncName(fv), fv, m...)
 }
 
 func (this *coreImpl) Start(ctx context.Context) {
@@ -141,29 +216,177 @@ func (this *coreImpl) Run(ctx context.Context) {
 }
 
 func (this *coreImpl) Close() error {
+	this.workers.set(nil)
 	this.ioLoop.Break()
 	return this.ioLoop.Close()
 }
 
-const kMaxRpcMsgBodyLen = 1024 * 1024 * 32
-
 func (this *coreImpl) NotifyCallableRead(call Callable, buf std.ReadableBuffer) {
+	decode := decodeRpcMsg
+	if base := baseOf(call); base != nil && base.jsonRpc != nil {
+		decode = base.jsonRpc.decode
+	} else if base != nil {
+		decode = base.decoder.decode
+	}
 	for {
-		rawMsg, err := decodeRpcMsg(buf, kMaxRpcMsgBodyLen)
+		if base := baseOf(call); base != nil && base.protocolBroken() {
+			// closing, frames left in buffer are dropped
+			break
+		}
+		// bytes buffered for single frame never exceed frame limit, max msg size applied after reassembled
+		rawMsg, err := decode(buf, this.maxFrameLen())
+		if protoErr, ok := err.(*ProtocolError); ok {
+			if this.reportProtocolError(call, protoErr) {
+				break
+			}
+			continue
+		}
 		if err != nil {
 			break
 		}
-		isReq := rawMsg.Type == ReqMsg
 		call.NotifyTimeWheel()
-		if isReq {
-			go this.handleReq(call, rawMsg)
-		} else {
-			this.handleAck(rawMsg)
+		base := baseOf(call)
+		if base != nil && base.heartbeat != nil {
+			base.heartbeat.alive()
+		}
+		if base != nil && rawMsg.framing == FramingV3 {
+			// peer speaks v3, answer it in v3 too
+			base.upgradeFraming(FramingV3)
+		}
+		if base != nil && !base.handshakeReady() && !isHandshakeFree(rawMsg.Type) {
+			this.rejectBeforeHandshake(call, rawMsg)
+			continue
+		}
+		this.dispatchMsg(call, rawMsg)
+	}
+}
+
+func (this *coreImpl) dispatchMsg(call Callable, rawMsg *RawMsg) {
+	switch rawMsg.Type {
+	case ReqMsg, NotifyMsg, StreamOpenMsg:
+		ctx := this.prepareReq(call, rawMsg)
+		this.runTask(call, rawMsg, func() {
+			this.handleReq(ctx)
+		}, func() {
+			ctx.Reset()
+			this.ReleaseContext(ctx)
+		})
+	case BatchMsg:
+		ctxs := this.prepareBatch(call, rawMsg)
+		if ctxs == nil {
+			return
 		}
+		this.runTask(call, rawMsg, func() {
+			this.handleBatch(call, rawMsg, ctxs)
+		}, func() {
+			this.releaseBatch(call, rawMsg, ctxs)
+		})
+	case AckMsg:
+		this.handleAck(call, rawMsg)
+	case CancelMsg:
+		this.handleCancel(call, rawMsg)
+	case StreamDataMsg, StreamEndMsg, StreamCreditMsg:
+		this.handleStreamFrame(call, rawMsg)
+	case FragmentMsg:
+		this.handleFragment(call, rawMsg)
+	case PingMsg:
+		if base := baseOf(call); base != nil {
+			base.pong(rawMsg)
+		}
+	case PongMsg:
+		if base := baseOf(call); base != nil && base.heartbeat != nil {
+			base.heartbeat.onPong(rawMsg)
+		}
+	case HelloMsg:
+		if base := baseOf(call); base != nil {
+			base.onHello(rawMsg)
+		}
+	case HelloAckMsg:
+		if base := baseOf(call); base != nil {
+			base.onHelloAck(rawMsg)
+		}
+	default:
+		log.Printf("coreImpl unknown msg type %d, Id -> %s\n", rawMsg.Type, keyOf(rawMsg))
+	}
+}
+
+func (this *coreImpl) handleFragment(call Callable, fragment *RawMsg) {
+	base := baseOf(call)
+	if base == nil {
+		return
+	}
+	rawMsg, err := base.fragments.append(fragment, this.maxMsgSize)
+	if err == ErrMsgTooLarge {
+		log.Printf("coreImpl msg Id -> %s,method -> %s,len %d exceed %d\n",
+			keyOf(fragment), fragment.MethodName, fragment.Total, this.maxMsgSize)
+		this.rejectTooLarge(call, fragment)
+		return
+	}
+	if err != nil {
+		this.reportProtocolError(call, newProtocolError(ProtoErrUnmarshal, "fragments of %s: %v", keyOf(fragment), err))
+		return
+	}
+	if rawMsg != nil {
+		this.dispatchMsg(call, rawMsg)
+	}
+}
+
+// fail caller instead of silent drop
+func (this *coreImpl) rejectTooLarge(call Callable, fragment *RawMsg) {
+	switch fragment.Origin {
+	case AckMsg:
+		this.donePending(call, keyOf(fragment), ErrMsgTooLarge, nil)
+	case ReqMsg, StreamOpenMsg, BatchMsg:
+		this.ackError(call, fragment, ErrMsgTooLarge)
+	}
+}
+
+// msgs allowed before handshake finished
+func isHandshakeFree(msgType MsgType) bool {
+	switch msgType {
+	case HelloMsg, HelloAckMsg, PingMsg, PongMsg:
+		return true
+	default:
+		return false
+	}
+}
+
+func (this *coreImpl) rejectBeforeHandshake(call Callable, rawMsg *RawMsg) {
+	log.Printf("coreImpl msg Id -> %s,method -> %s,type %d rejected before handshake\n",
+		keyOf(rawMsg), rawMsg.MethodName, rawMsg.Type)
+	switch rawMsg.Type {
+	case ReqMsg, StreamOpenMsg, BatchMsg:
+		this.ackError(call, rawMsg, ErrHandshakeRequired)
+	}
+}
+
+func (this *coreImpl) ackError(call Callable, inMsg *RawMsg, ackErr error) {
+	ackMsg := &RawMsg{
+		Id:         inMsg.Id,
+		Seq:        inMsg.Seq,
+		MethodName: inMsg.MethodName,
+		Type:       AckMsg,
+	}
+	ackMsg.SetError(ackErr)
+	ackBytes, err := encodeRpcMsgWith(ackMsg, encoderOf(call, ackMsg.MethodName))
+	if err != nil {
+		return
+	}
+	if writer := call.Writer(); writer != nil {
+		writer.Write(nil, ackBytes, false)
 	}
 }
 
-var errRpcFuncNotFound = errors.New("core func not found")
+// returns true if callable won't accept more frames
+func (this *coreImpl) reportProtocolError(call Callable, err *ProtocolError) bool {
+	if base := baseOf(call); base != nil {
+		return base.onProtocolError(err)
+	}
+	log.Println("callable got ", err)
+	return false
+}
+
+var ErrFuncNotFound = errors.New("core func not found")
 
 func (this *coreImpl) execWithMiddleware(c Context) {
 	ctx := c.(*contextImpl)
@@ -172,7 +395,7 @@ func (this *coreImpl) execWithMiddleware(c Context) {
 	if fn != nil {
 		ctx.SetRequestType(fn.inParamType)
 		ctx.SetResponseType(fn.outParamType)
-		inParam, err := fn.decodeInParam(ctx.reqMsg.Data)
+		inParam, err := fn.decodeInParam(ctx.reqMsg)
 		if err != nil {
 			ctx.SetError(err)
 			return
@@ -182,7 +405,7 @@ func (this *coreImpl) execWithMiddleware(c Context) {
 		fnProxy = fn.handleFunc
 		ctx.localFnDesc = fn.handleFuncDesc
 	} else {
-		ctx.SetError(errRpcFuncNotFound)
+		ctx.SetError(ErrFuncNotFound)
 		return
 	}
 	//
@@ -190,37 +413,110 @@ func (this *coreImpl) execWithMiddleware(c Context) {
 	fnProxy(ctx)
 }
 
-func (this *coreImpl) handleReq(cli Callable, inMsg *RawMsg) {
+// invoked in loop, so that cancel msg and stream frames followed could find req
+func (this *coreImpl) prepareReq(cli Callable, inMsg *RawMsg) Context {
 	ctx := this.GrabContext()
+	ctx.Init(cli, inMsg)
+	cancel := ctx.(*contextImpl).initGoContext()
+	base := baseOf(cli)
+	if base != nil && inMsg.Type != NotifyMsg {
+		key := keyOf(inMsg)
+		base.inflight.add(key, cancel)
+		ctx.AddDefer(func() {
+			base.inflight.remove(key)
+		})
+	}
+	if inMsg.Type == StreamOpenMsg {
+		if base == nil {
+			ctx.SetError(errStreamNotSupport)
+		} else {
+			stream := newAcceptedStream(this, ctx, inMsg)
+			ctx.(*contextImpl).stream = stream
+			key := keyOf(inMsg)
+			base.streams.add(key, true, stream)
+			ctx.AddDefer(func() {
+				base.streams.remove(key, true)
+			})
+		}
+	}
+	return ctx
+}
+
+func (this *coreImpl) handleReq(ctx Context) {
 	defer func() {
 		ctx.Reset()
 		this.ReleaseContext(ctx)
 	}()
-	ctx.Init(cli, inMsg)
+	inMsg := ctx.ReqMsg()
+	isNotify := inMsg.Type == NotifyMsg
+	this.invokeReq(ctx)
 	//
-	proxy := this.execWithMiddleware
-	if this.preUseMiddleware.Len() != 0 {
-		proxy = this.preUseMiddleware.buildChain(proxy)
+	if isNotify {
+		if err := ctx.Error(); err != nil {
+			log.Printf("coreImpl handle NOTIFY Id -> %s,method -> %s,error -> %v\n", keyOf(inMsg), inMsg.MethodName, err)
+		}
+		return // notify never ack
+	}
+	if ctx.GoContext().Err() != nil {
+		return // caller gave up or deadline exceeded, nobody waiting for ack
 	}
-	proxy(ctx)
-	//
 	outMsg, err := ctx.BuildOutMsg()
 	if err != nil {
-		log.Printf("coreImpl handle REQ Id -> %s,build output msg error -> %v\n", inMsg.Id, err)
+		log.Printf("coreImpl handle REQ Id -> %s,build output msg error -> %v\n", keyOf(inMsg), err)
 		return // build rpcMsg failed
 	}
-	sendBytes, err := encodeRpcMsg(outMsg)
+	frames, err := encodeRpcFrames(outMsg, this.maxMsgSize, encoderOf(ctx.Callable(), outMsg.MethodName))
+	if err == ErrMsgTooLarge {
+		// tell caller instead of silent drop
+		outMsg.Data = nil
+		outMsg.SetError(err)
+		frames, err = encodeRpcFrames(outMsg, this.maxMsgSize, encoderOf(ctx.Callable(), outMsg.MethodName))
+	}
 	if err != nil {
-		log.Printf("coreImpl handle REQ Id -> %s,marshal output msg error -> %v\n", inMsg.Id, err)
+		log.Printf("coreImpl handle REQ Id -> %s,marshal output msg error -> %v\n", keyOf(inMsg), err)
 		return // encode rpcMsg failed
 	}
-	if writer := ctx.Writer(); writer != nil {
-		writer.Write(ctx, sendBytes, false)
+	writeFrames(ctx.Writer(), ctx, frames)
+}
+
+func (this *coreImpl) invokeReq(ctx Context) {
+	proxy := this.execWithMiddleware
+	if this.preUseMiddleware.Len() != 0 {
+		proxy = this.preUseMiddleware.buildChain(proxy)
 	}
+	proxy(ctx)
 }
 
-func (this *coreImpl) handleAck(inMsg *RawMsg) {
-	this.promiseGroup.DonePromise(std.PromiseId(inMsg.Id), inMsg.GetError(), inMsg)
+func (this *coreImpl) handleAck(call Callable, inMsg *RawMsg) {
+	this.donePending(call, keyOf(inMsg), inMsg.GetError(), inMsg)
+}
+
+// calls of BaseCallable are done through its pending calls, only calls issued by it could be done by its peer.
+// other callables keep their calls in promise group of core
+func (this *coreImpl) donePending(call Callable, key msgKey, err error, ackMsg *RawMsg) {
+	base := baseOf(call)
+	if base == nil {
+		this.promiseGroup.DonePromise(std.PromiseId(key.id), err, ackMsg)
+		return
+	}
+	pending, ok := base.pending.get(key)
+	if !ok {
+		log.Printf("coreImpl drop ack of unknown call, msg Id -> %s\n", key)
+		return
+	}
+	pending.done(key, err, ackMsg)
+}
+
+func (this *coreImpl) handleCancel(cli Callable, inMsg *RawMsg) {
+	if base := baseOf(cli); base != nil {
+		base.inflight.cancel(keyOf(inMsg))
+	}
+}
+
+func (this *coreImpl) handleStreamFrame(cli Callable, inMsg *RawMsg) {
+	if base := baseOf(cli); base != nil {
+		base.streams.dispatch(inMsg)
+	}
 }
 
 func (this *coreImpl) BuildChain(h HandleFunc) HandleFunc {
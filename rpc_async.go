@@ -0,0 +1,219 @@
+package rpcx
+
+import (
+	"context"
+	"github.com/gen-iot/std"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// result of CallAsync, done when ack received, timeout or callable closed
+type CallFuture struct {
+	name      string
+	msk       int32
+	done      chan struct{}
+	ackHeader RpcMsgHeader
+	err       error
+	lock      sync.Mutex
+	callbacks []func(f *CallFuture)
+}
+
+func newCallFuture(name string) *CallFuture {
+	return &CallFuture{
+		name:      name,
+		done:      make(chan struct{}),
+		callbacks: make([]func(f *CallFuture), 0),
+	}
+}
+
+func (this *CallFuture) Method() string {
+	return this.name
+}
+
+// closed after call done, select it with other events
+func (this *CallFuture) Done() <-chan struct{} {
+	return this.done
+}
+
+// block until call done, out is filled if err is nil
+func (this *CallFuture) Wait() (ackHeader RpcMsgHeader, err error) {
+	<-this.done
+	return this.ackHeader, this.err
+}
+
+// only valid after done
+func (this *CallFuture) AckHeader() RpcMsgHeader {
+	return this.ackHeader
+}
+
+// only valid after done
+func (this *CallFuture) Err() error {
+	return this.err
+}
+
+// cb invoked in new goroutine once call done, immediately if done already
+func (this *CallFuture) OnDone(cb func(f *CallFuture)) *CallFuture {
+	this.lock.Lock()
+	if atomic.LoadInt32(&this.msk) == 0 {
+		this.callbacks = append(this.callbacks, cb)
+		this.lock.Unlock()
+		return this
+	}
+	this.lock.Unlock()
+	go func() {
+		<-this.done
+		cb(this)
+	}()
+	return this
+}
+
+func (this *CallFuture) complete(ackHeader RpcMsgHeader, err error) {
+	this.lock.Lock()
+	atomic.StoreInt32(&this.msk, 1)
+	callbacks := this.callbacks
+	this.callbacks = nil
+	this.lock.Unlock()
+	this.ackHeader = ackHeader
+	this.err = err
+	close(this.done)
+	for _, cb := range callbacks {
+		go cb(this)
+	}
+}
+
+// call issued by CallAsync, done by ack, timeout or callable closed, whichever first
+type asyncCall struct {
+	call    *BaseCallable
+	ctx     Context
+	out     interface{}
+	mids    []MiddlewareFunc
+	future  *CallFuture
+	key     msgKey
+	msk     int32
+	lock    sync.Mutex
+	timer   *time.Timer
+	written chan struct{} // closed after first run of caller chain returned
+}
+
+// issue call without blocking caller, out filled before future done.
+// caller chain runs twice without goroutine waiting for ack: before request written, then once call done,
+// Response of ctx is set only in the second run
+func (this *BaseCallable) CallAsync(timeout time.Duration, name string, headers RpcMsgHeader, in, out interface{}, mids ...MiddlewareFunc) *CallFuture {
+	std.Assert(this.writer != nil, "stream is nil!")
+	async := &asyncCall{
+		call:    this,
+		ctx:     this.newCallContext(nil, ReqMsg, name, headers, in, out),
+		out:     out,
+		mids:    mids,
+		future:  newCallFuture(name),
+		written: make(chan struct{}),
+	}
+	this.buildCallChain(func(ctx Context) {
+		async.perform(timeout, ctx)
+	}, mids...)(async.ctx)
+	close(async.written)
+	if atomic.LoadInt32(&async.msk) == 0 && async.timer == nil {
+		// never written, e.g. handshake not finished or chain broke
+		atomic.StoreInt32(&async.msk, 1)
+		async.finish(async.ctx.Error(), nil)
+	}
+	return async.future
+}
+
+func (this *asyncCall) perform(timeout time.Duration, c Context) {
+	ctx := c.(*contextImpl)
+	if !this.call.handshakeReady() {
+		ctx.SetError(ErrHandshakeRequired)
+		return
+	}
+	reqMsg := ctx.reqMsg
+	if err := reqMsg.SetData(ctx.in); err != nil {
+		ctx.SetError(err)
+		return
+	}
+	reqMsg.Timeout = remainingMilliseconds(time.Now().Add(timeout))
+	frames, err := encodeRpcFrames(reqMsg, this.call.core.MaxMsgSize(), this.call.frameEncoder(reqMsg.MethodName))
+	if err != nil {
+		ctx.SetError(err)
+		return
+	}
+	this.key = keyOf(reqMsg)
+	if !this.call.pending.add(this.key, pendingCall{async: this}) {
+		ctx.SetError(ErrCallableClosed)
+		return
+	}
+	writer := ctx.Writer()
+	this.lock.Lock()
+	this.timer = time.AfterFunc(timeout, func() {
+		if this.tryDone() {
+			this.call.sendCancel(writer, nil, reqMsg)
+			this.finish(std.ErrFutureTimeout, nil)
+		}
+	})
+	this.lock.Unlock()
+	writeFrames(writer, ctx, frames)
+}
+
+// only the first of ack, timeout and close takes effect
+func (this *asyncCall) tryDone() bool {
+	if !atomic.CompareAndSwapInt32(&this.msk, 0, 1) {
+		return false
+	}
+	this.call.pending.remove(this.key)
+	this.lock.Lock()
+	if this.timer != nil {
+		this.timer.Stop()
+	}
+	this.lock.Unlock()
+	return true
+}
+
+// invoked in loop by ack, caller chain runs in new goroutine so that loop never blocked by it
+func (this *asyncCall) done(err error, ackMsg *RawMsg) {
+	if this.tryDone() {
+		go this.finish(err, ackMsg)
+	}
+}
+
+// second run of caller chain, binds out and completes future
+func (this *asyncCall) finish(err error, ackMsg *RawMsg) {
+	<-this.written
+	ctx := this.ctx
+	if this.timer != nil {
+		invoke := this.call.buildInvoke(func(c Context) {
+			if ackMsg == nil {
+				c.SetError(err)
+				return
+			}
+			c.SetAckMsg(ackMsg)
+			c.SetError(ackMsg.GetError())
+		}, ctx, this.out)
+		this.call.buildCallChain(invoke, this.mids...)(ctx)
+	}
+	this.future.complete(ctx.ResponseHeader(), ctx.Error())
+	ctx.Reset()
+	this.call.core.ReleaseContext(ctx)
+}
+
+// wait until all futures done, first error in order returned
+func WaitAll(futures ...*CallFuture) error {
+	return WaitAllContext(context.Background(), futures...)
+}
+
+// returns goCtx.Err() as soon as goCtx done, futures keep running
+func WaitAllContext(goCtx context.Context, futures ...*CallFuture) error {
+	for _, f := range futures {
+		select {
+		case <-f.Done():
+		case <-goCtx.Done():
+			return goCtx.Err()
+		}
+	}
+	for _, f := range futures {
+		if f.err != nil {
+			return f.err
+		}
+	}
+	return nil
+}
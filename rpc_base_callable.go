@@ -1,14 +1,20 @@
 package rpcx
 
 import (
+	"context"
+	"errors"
 	"github.com/gen-iot/liblpc/v2"
 	"github.com/gen-iot/std"
 	"io"
 	"log"
 	"reflect"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
+var ErrCallableClosed = errors.New("callable closed")
+
 type RpcMsgHeader = map[string]string
 
 type Writer interface {
@@ -46,9 +52,154 @@ func (this *CallableCallbacks) SetOnClose(cb CallableCallback) {
 	this.closeCb = cb
 }
 
+// pending calls issued by one callable,
+// all of them will be completed immediately once callable closed
+type pendingCalls struct {
+	calls  map[msgKey]pendingCall
+	lock   *sync.Mutex
+	closed bool
+}
+
+type pendingCall struct {
+	promise std.Promise
+	async   *asyncCall
+	origin  *BaseCallable // set if call issued by other callable, its ack accepted by this one
+}
+
+// done call with ack received or error
+func (this pendingCall) done(key msgKey, err error, ackMsg *RawMsg) {
+	if this.async != nil {
+		this.async.done(err, ackMsg)
+		return
+	}
+	if this.promise != nil {
+		this.promise.DoneData(err, ackMsg)
+		return
+	}
+	if call, ok := this.origin.pending.get(key); ok && call.origin == nil {
+		call.done(key, err, ackMsg)
+	}
+}
+
+func newPendingCalls() *pendingCalls {
+	return &pendingCalls{
+		calls:  make(map[msgKey]pendingCall),
+		lock:   &sync.Mutex{},
+		closed: false,
+	}
+}
+
+// return false if already closed
+func (this *pendingCalls) add(key msgKey, call pendingCall) bool {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if this.closed {
+		return false
+	}
+	this.calls[key] = call
+	return true
+}
+
+func (this *pendingCalls) remove(key msgKey) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	delete(this.calls, key)
+}
+
+// ok if call of key issued by this callable and not done yet
+func (this *pendingCalls) get(key msgKey) (pendingCall, bool) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	call, ok := this.calls[key]
+	return call, ok
+}
+
+// mark closed and return all pending calls
+func (this *pendingCalls) close() map[msgKey]pendingCall {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if this.closed {
+		return nil
+	}
+	this.closed = true
+	out := this.calls
+	this.calls = make(map[msgKey]pendingCall)
+	return out
+}
+
+// requests from remote which are still handling
+type inflightCalls struct {
+	cancels map[msgKey]context.CancelFunc
+	lock    *sync.Mutex
+}
+
+func newInflightCalls() *inflightCalls {
+	return &inflightCalls{
+		cancels: make(map[msgKey]context.CancelFunc),
+		lock:    &sync.Mutex{},
+	}
+}
+
+func (this *inflightCalls) add(key msgKey, cancel context.CancelFunc) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.cancels[key] = cancel
+}
+
+func (this *inflightCalls) remove(key msgKey) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	delete(this.cancels, key)
+}
+
+func (this *inflightCalls) cancel(key msgKey) {
+	this.lock.Lock()
+	cancel, ok := this.cancels[key]
+	delete(this.cancels, key)
+	this.lock.Unlock()
+	if ok {
+		cancel()
+	}
+}
+
+func (this *inflightCalls) cancelAll() {
+	this.lock.Lock()
+	cancels := this.cancels
+	this.cancels = make(map[msgKey]context.CancelFunc)
+	this.lock.Unlock()
+	for _, cancel := range cancels {
+		cancel()
+	}
+}
+
+// implemented by BaseCallable, core use it to reach per callable states
+type baseCallableHolder interface {
+	baseCallable() *BaseCallable
+}
+
+func baseOf(call Callable) *BaseCallable {
+	if holder, ok := call.(baseCallableHolder); ok {
+		return holder.baseCallable()
+	}
+	return nil
+}
+
 type BaseCallable struct {
-	core   Core
-	writer WriterCloser
+	core      Core
+	writer    WriterCloser
+	pending   *pendingCalls
+	inflight  *inflightCalls
+	streams   *streamRegistry
+	fragments *fragmentAssembler
+	decoder   *frameDecoder
+	heartbeat *heartbeat
+	handshake *handshake
+	peer      atomic.Value // *PeerInfo
+	framing   int32
+	protoErrs protocolErrors
+	msgIds    *msgIdGenerator
+	jsonRpc   *jsonRpcWire
+	workers   workerPoolHolder
 	CallableCallbacks
 	middleware
 	liblpc.BaseUserData
@@ -57,8 +208,15 @@ type BaseCallable struct {
 
 func NewBaseCallable(core Core, writer WriterCloser, driven Callable) *BaseCallable {
 	bCall := &BaseCallable{
-		core:   core,
-		writer: writer,
+		core:      core,
+		writer:    writer,
+		pending:   newPendingCalls(),
+		inflight:  newInflightCalls(),
+		streams:   newStreamRegistry(),
+		fragments: newFragmentAssembler(),
+		decoder:   newFrameDecoder(),
+		framing:   FramingV2,
+		msgIds:    newMsgIdGenerator(),
 	}
 	if driven == nil {
 		driven = bCall
@@ -100,21 +258,55 @@ func (this *BaseCallable) Call5(timeout time.Duration, name string, in, out inte
 }
 
 func (this *BaseCallable) Call6(timeout time.Duration, name string, headers RpcMsgHeader, in, out interface{}, mids ...MiddlewareFunc) (ackHeader RpcMsgHeader, err error) {
+	return this.call(nil, ReqMsg, func(ctx Context) {
+		this.Perform(timeout, ctx)
+	}, name, headers, in, out, mids...)
+}
+
+// call returns as soon as goCtx done, and report goCtx.Err()
+func (this *BaseCallable) CallContext(goCtx context.Context, name string, headers RpcMsgHeader, in, out interface{}, mids ...MiddlewareFunc) (ackHeader RpcMsgHeader, err error) {
+	std.Assert(goCtx != nil, "goCtx is nil")
+	return this.call(goCtx, ReqMsg, func(ctx Context) {
+		this.PerformContext(goCtx, ctx)
+	}, name, headers, in, out, mids...)
+}
+
+// fire and forget, callee won't ack
+func (this *BaseCallable) Notify(name string, headers RpcMsgHeader, in interface{}, mids ...MiddlewareFunc) error {
+	_, err := this.call(nil, NotifyMsg, this.performNotify, name, headers, in, nil, mids...)
+	return err
+}
+
+func (this *BaseCallable) call(goCtx context.Context, msgType MsgType, perform HandleFunc, name string, headers RpcMsgHeader, in, out interface{}, mids ...MiddlewareFunc) (ackHeader RpcMsgHeader, err error) {
 	std.Assert(this.writer != nil, "stream is nil!")
-	msgId := std.GenRandomUUID()
+	//add promise
+	ctx := this.newCallContext(goCtx, msgType, name, headers, in, out)
+	defer func() {
+		ctx.Reset()
+		this.core.ReleaseContext(ctx)
+	}()
+	invoke := this.buildInvoke(perform, ctx, out)
+	this.buildCallChain(invoke, mids...)(ctx)
+	return ctx.ResponseHeader(), ctx.Error()
+}
+
+// context of call issued by local, release it after call done
+func (this *BaseCallable) newCallContext(goCtx context.Context, msgType MsgType, name string, headers RpcMsgHeader, in, out interface{}) Context {
+	msgId, seq := this.nextMsgId()
 	msg := &RawMsg{
 		Id:         msgId,
+		Seq:        seq,
 		MethodName: name,
 		Headers:    headers,
-		Type:       ReqMsg,
+		Type:       msgType,
+		Codec:      codecName(this.codec()),
 	}
-	//add promise
 	ctx := this.core.GrabContext()
-	defer func() {
-		ctx.Reset()
-		this.core.ReleaseContext(ctx)
-	}()
 	ctx.Init(this, msg)
+	ctx.(*contextImpl).issued = true
+	if goCtx != nil {
+		ctx.SetGoContext(goCtx)
+	}
 	if in != nil {
 		ctx.SetRequestType(reflect.TypeOf(in))
 		ctx.SetFuncDesc(ctx.FuncDesc() | ReqHasData)
@@ -129,7 +321,10 @@ func (this *BaseCallable) Call6(timeout time.Duration, name string, headers RpcM
 		ctx.SetFuncDesc(ctx.FuncDesc() | RspHasData)
 		ctx.SetResponseType(outValue.Type())
 	}
-	invoke := this.buildInvoke(timeout, ctx, out)
+	return ctx
+}
+
+func (this *BaseCallable) buildCallChain(invoke HandleFunc, mids ...MiddlewareFunc) HandleFunc {
 	var handleF HandleFunc = nil
 	if len(mids) == 0 && this.middleware.Len() == 0 {
 		handleF = this.core.BuildChain(invoke) // use core default chain
@@ -139,31 +334,94 @@ func (this *BaseCallable) Call6(timeout time.Duration, name string, headers RpcM
 		// if mids not empty ,override callable itself mids
 		handleF = middlewareList(mids).build(invoke)
 	}
-	handleF = this.core.BuildPreUsedChain(handleF) // prepend preUsed chain
-	handleF(ctx)
-	return ctx.ResponseHeader(), ctx.Error()
+	return this.core.BuildPreUsedChain(handleF) // prepend preUsed chain
+}
+
+// ack of call issued by other callable accepted by this one, e.g. calls relayed through mq.
+// acks of calls not issued or accepted by a callable are dropped.
+// invoke returned func once call done
+func (this *BaseCallable) AcceptAck(ctx Context) (release func()) {
+	origin := baseOf(ctx.Callable())
+	key := keyOf(ctx.ReqMsg())
+	if origin == nil || !this.pending.add(key, pendingCall{origin: origin}) {
+		return func() {}
+	}
+	return func() {
+		this.pending.remove(key)
+	}
 }
 
 func (this *BaseCallable) Start() {
 	this.NotifyTimeWheel()
+	this.startHeartbeat()
 }
 
 func (this *BaseCallable) Close() error {
+	// stop pinging before stream closed
+	this.stopHeartbeat()
+	var err error = nil
 	if this.writer != nil {
-		return this.writer.Close()
+		err = this.writer.Close()
 	}
-	return nil
+	this.workers.set(nil)
+	this.failPending(ErrCallableClosed)
+	this.inflight.cancelAll()
+	return err
+}
+
+func (this *BaseCallable) baseCallable() *BaseCallable {
+	return this
+}
+
+// framing used to send msgs to peer
+func (this *BaseCallable) Framing() int {
+	return int(atomic.LoadInt32(&this.framing))
+}
+
+// never downgrade, peer keeps decoding lower framing
+func (this *BaseCallable) upgradeFraming(framing int) {
+	if framing > this.core.Framing() {
+		framing = this.core.Framing()
+	}
+	for {
+		current := atomic.LoadInt32(&this.framing)
+		if int32(framing) <= current {
+			return
+		}
+		if atomic.CompareAndSwapInt32(&this.framing, current, int32(framing)) {
+			return
+		}
+	}
+}
+
+// codec of calls issued by this callable
+func (this *BaseCallable) codec() Codec {
+	if this.jsonRpc != nil {
+		return JsonRpcCodec
+	}
+	return this.core.Codec()
+}
+
+func (this *BaseCallable) encodeMsg(msg *RawMsg) ([]byte, error) {
+	return encodeRpcMsgWith(msg, this.frameEncoder(msg.MethodName))
 }
 
-func (this *BaseCallable) buildInvoke(timeout time.Duration, ctx Context, out interface{}) HandleFunc {
+// complete all pending calls with err, no more calls will be accepted after that
+func (this *BaseCallable) failPending(err error) {
+	for key, call := range this.pending.close() {
+		call.done(key, err, nil)
+	}
+}
+
+func (this *BaseCallable) buildInvoke(perform HandleFunc, ctx Context, out interface{}) HandleFunc {
 	return func(Context) {
-		this.____invoke(timeout, out, ctx)
+		this.____invoke(perform, out, ctx)
 	}
 }
 
 // dont call this func directly
-func (this *BaseCallable) ____invoke(timeout time.Duration, out interface{}, ctx Context) {
-	this.Perform(timeout, ctx)
+func (this *BaseCallable) ____invoke(perform HandleFunc, out interface{}, ctx Context) {
+	perform(ctx)
 	if ctx.AckMsg() == nil {
 		return
 	}
@@ -180,9 +438,9 @@ func (this *BaseCallable) ____invoke(timeout time.Duration, out interface{}, ctx
 		ctx.SetResponse(out)
 		return
 	}
-	err := gRpcSerialization.UnMarshal(ctx.AckMsg().Data, out)
+	err := ctx.AckMsg().BindData(out)
 	if err != nil {
-		log.Printf("call [%s]:MsgpackUnmarshal got err ->%v\n", ctx.Method(), err)
+		log.Printf("call [%s]:unmarshal ack data got err ->%v\n", ctx.Method(), err)
 		if ctx.Error() != nil {
 			ctx.SetError(std.CombinedErrors{ctx.Error(), err})
 		} else {
@@ -193,39 +451,122 @@ func (this *BaseCallable) ____invoke(timeout time.Duration, out interface{}, ctx
 }
 
 func (this *BaseCallable) Perform(timeout time.Duration, c Context) {
+	goCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	this.PerformContext(goCtx, c)
+	if c.Error() == context.DeadlineExceeded {
+		c.SetError(std.ErrFutureTimeout)
+	}
+}
+
+func (this *BaseCallable) PerformContext(goCtx context.Context, c Context) {
 	ctx := c.(*contextImpl)
+	if err := goCtx.Err(); err != nil {
+		ctx.SetError(err)
+		return
+	}
+	if !this.handshakeReady() {
+		ctx.SetError(ErrHandshakeRequired)
+		return
+	}
 	err := ctx.reqMsg.SetData(ctx.in)
 	if err != nil {
 		ctx.SetError(err)
 		return
 	}
-	promise := std.NewPromise()
-	promiseId := std.PromiseId(ctx.Id())
-	//write out
-	outBytes, err := encodeRpcMsg(ctx.reqMsg)
+	ackMsg, err := this.roundTrip(goCtx, ctx.Writer(), ctx, ctx.reqMsg)
 	if err != nil {
 		ctx.SetError(err)
+	}
+	if ackMsg == nil {
 		return
 	}
-	this.core.PromiseGroup().AddPromise(promiseId, promise)
-	defer this.core.PromiseGroup().RemovePromise(promiseId)
-	//
-	if writer := ctx.Writer(); writer != nil {
-		writer.Write(ctx, outBytes, false)
+	ctx.ackMsg = ackMsg
+	ctx.SetError(ackMsg.GetError())
+}
+
+// send req and wait for ack, ack could be nil if error returned
+func (this *BaseCallable) roundTrip(goCtx context.Context, writer Writer, ctx Context, reqMsg *RawMsg) (*RawMsg, error) {
+	reqMsg.Timeout = 0
+	if deadline, ok := goCtx.Deadline(); ok {
+		reqMsg.Timeout = remainingMilliseconds(deadline)
 	}
-	//wait for data
-	future := promise.GetFuture()
-	ackMsgObj, err := future.WaitData(timeout)
+	promise := newCallPromise()
+	key := keyOf(reqMsg)
+	//write out
+	frames, err := encodeRpcFrames(reqMsg, this.core.MaxMsgSize(), this.frameEncoder(reqMsg.MethodName))
 	if err != nil {
-		ctx.SetError(err)
+		return nil, err
+	}
+	if !this.pending.add(key, pendingCall{promise: promise}) {
+		return nil, ErrCallableClosed
 	}
+	defer this.pending.remove(key)
+	//
+	writeFrames(writer, ctx, frames)
+	//wait for data
+	select {
+	case <-promise.DoneChan():
+	case <-goCtx.Done():
+		this.sendCancel(writer, ctx, reqMsg)
+		return nil, goCtx.Err()
+	}
+	ackMsgObj, err := promise.Result()
 	if ackMsgObj == nil {
-		return
+		return nil, err
 	}
 	ackMsg, ok := ackMsgObj.(*RawMsg)
 	std.Assert(ok, "type mismatched ,RawMsg")
-	ctx.ackMsg = ackMsg
-	ctx.SetError(ackMsg.GetError())
+	return ackMsg, err
+}
+
+func (this *BaseCallable) performNotify(c Context) {
+	ctx := c.(*contextImpl)
+	if !this.handshakeReady() {
+		ctx.SetError(ErrHandshakeRequired)
+		return
+	}
+	err := ctx.reqMsg.SetData(ctx.in)
+	if err != nil {
+		ctx.SetError(err)
+		return
+	}
+	frames, err := encodeRpcFrames(ctx.reqMsg, this.core.MaxMsgSize(), this.frameEncoder(ctx.reqMsg.MethodName))
+	if err != nil {
+		ctx.SetError(err)
+		return
+	}
+	writeFrames(ctx.Writer(), ctx, frames)
+}
+
+// tell callee stop handling request
+func (this *BaseCallable) sendCancel(writer Writer, ctx Context, reqMsg *RawMsg) {
+	if writer == nil || this.jsonRpc != nil {
+		return
+	}
+	cancelBytes, err := this.encodeMsg(&RawMsg{
+		Id:         reqMsg.Id,
+		Seq:        reqMsg.Seq,
+		MethodName: reqMsg.MethodName,
+		Type:       CancelMsg,
+	})
+	if err != nil {
+		log.Printf("call [%s]:encode cancel msg error -> %v\n", reqMsg.MethodName, err)
+		return
+	}
+	writer.Write(ctx, cancelBytes, false)
+}
+
+func remainingMilliseconds(deadline time.Time) int64 {
+	remain := time.Until(deadline)
+	ms := int64(remain / time.Millisecond)
+	if remain%time.Millisecond != 0 {
+		ms++
+	}
+	if ms <= 0 {
+		ms = 1
+	}
+	return ms
 }
 
 func (this *BaseCallable) Writer() Writer {
@@ -0,0 +1,304 @@
+package rpcx
+
+import (
+	"context"
+	"errors"
+	"github.com/gen-iot/std"
+	"log"
+	"reflect"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var ErrBatchMismatched = errors.New("batch acks mismatched")
+
+// goroutines running items of one parallel batch when worker pool disabled
+const kMaxBatchParallel = 32
+
+// one call of batch, result is valid after batch done
+type BatchCall struct {
+	name      string
+	headers   RpcMsgHeader
+	in        interface{}
+	out       interface{}
+	ackHeader RpcMsgHeader
+	err       error
+}
+
+func (this *BatchCall) Method() string {
+	return this.name
+}
+
+func (this *BatchCall) AckHeader() RpcMsgHeader {
+	return this.ackHeader
+}
+
+func (this *BatchCall) Err() error {
+	return this.err
+}
+
+// collect many calls and send them in one frame, callee acks all results in one frame.
+// callable middlewares are not applied on calls of batch
+type Batch struct {
+	call     *BaseCallable
+	calls    []*BatchCall
+	parallel bool
+}
+
+func (this *BaseCallable) Batch() *Batch {
+	return &Batch{
+		call:  this,
+		calls: make([]*BatchCall, 0),
+	}
+}
+
+// callee handles calls of batch concurrently, bounded by worker pool if enabled, otherwise one by one in order
+func (this *Batch) SetParallel(parallel bool) *Batch {
+	this.parallel = parallel
+	return this
+}
+
+func (this *Batch) Len() int {
+	return len(this.calls)
+}
+
+func (this *Batch) Add(name string, in, out interface{}) *BatchCall {
+	return this.AddWithHeaders(name, nil, in, out)
+}
+
+func (this *Batch) AddWithHeaders(name string, headers RpcMsgHeader, in, out interface{}) *BatchCall {
+	if out != nil {
+		outValue := reflect.ValueOf(out)
+		std.Assert(outValue.Kind() == reflect.Ptr, "out must be a pointer")
+		std.Assert(!outValue.IsNil(), "out underlying ptr must not be nil")
+	}
+	bCall := &BatchCall{
+		name:    name,
+		headers: headers,
+		in:      in,
+		out:     out,
+	}
+	this.calls = append(this.calls, bCall)
+	return bCall
+}
+
+func (this *Batch) Do(timeout time.Duration) error {
+	goCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	err := this.DoContext(goCtx)
+	if err == context.DeadlineExceeded {
+		return std.ErrFutureTimeout
+	}
+	return err
+}
+
+// error returned if batch itself failed, check BatchCall.Err for each call
+func (this *Batch) DoContext(goCtx context.Context) error {
+	std.Assert(goCtx != nil, "goCtx is nil")
+	std.Assert(this.call.writer != nil, "stream is nil!")
+	if len(this.calls) == 0 {
+		return nil
+	}
+	if err := goCtx.Err(); err != nil {
+		return err
+	}
+	if !this.call.handshakeReady() {
+		return ErrHandshakeRequired
+	}
+	codec := codecName(this.call.codec())
+	items := make([]*RawMsg, 0, len(this.calls))
+	for _, bCall := range this.calls {
+		item := &RawMsg{
+			MethodName: bCall.name,
+			Headers:    bCall.headers,
+			Type:       ReqMsg,
+			Codec:      codec,
+		}
+		if err := item.SetData(bCall.in); err != nil {
+			return err
+		}
+		items = append(items, item)
+	}
+	data, err := gRpcSerialization.Marshal(items)
+	if err != nil {
+		return err
+	}
+	msgId, seq := this.call.nextMsgId()
+	batchMsg := &RawMsg{
+		Id:       msgId,
+		Seq:      seq,
+		Type:     BatchMsg,
+		Parallel: this.parallel,
+		Data:     data,
+	}
+	ackMsg, err := this.call.roundTrip(goCtx, this.call.writer, nil, batchMsg)
+	if err != nil {
+		return err
+	}
+	if err = ackMsg.GetError(); err != nil {
+		return err
+	}
+	acks := make([]*RawMsg, 0, len(this.calls))
+	if err = gRpcSerialization.UnMarshal(ackMsg.Data, &acks); err != nil {
+		return err
+	}
+	if len(acks) != len(this.calls) {
+		return ErrBatchMismatched
+	}
+	for idx, bCall := range this.calls {
+		this.bindAck(bCall, acks[idx])
+	}
+	return nil
+}
+
+func (this *Batch) bindAck(bCall *BatchCall, ack *RawMsg) {
+	bCall.ackHeader = ack.Headers
+	bCall.err = ack.GetError()
+	if bCall.out == nil || len(ack.Data) == 0 {
+		return
+	}
+	if err := ack.BindData(bCall.out); err != nil && bCall.err == nil {
+		bCall.err = err
+	}
+}
+
+// invoked in loop, so that cancel msg followed could find batch
+func (this *coreImpl) prepareBatch(call Callable, batchMsg *RawMsg) []Context {
+	items := make([]*RawMsg, 0)
+	if err := gRpcSerialization.UnMarshal(batchMsg.Data, &items); err != nil {
+		this.reportProtocolError(call, newProtocolError(ProtoErrUnmarshal, "batch %s: %v", keyOf(batchMsg), err))
+		this.ackError(call, batchMsg, err)
+		return nil
+	}
+	batchId := batchMsg.Id
+	if base := baseOf(call); base != nil {
+		batchId = base.msgIdOf(batchMsg, false)
+	}
+	ctxs := make([]Context, 0, len(items))
+	cancels := make([]context.CancelFunc, 0, len(items))
+	for idx, item := range items {
+		item.Id = batchId + "/" + strconv.Itoa(idx)
+		item.Type = ReqMsg
+		item.Timeout = batchMsg.Timeout
+		ctx := this.GrabContext()
+		ctx.Init(call, item)
+		cancels = append(cancels, ctx.(*contextImpl).initGoContext())
+		ctxs = append(ctxs, ctx)
+	}
+	if base := baseOf(call); base != nil {
+		base.inflight.add(keyOf(batchMsg), func() {
+			for _, cancel := range cancels {
+				cancel()
+			}
+		})
+	}
+	return ctxs
+}
+
+func (this *coreImpl) releaseBatch(call Callable, batchMsg *RawMsg, ctxs []Context) {
+	if base := baseOf(call); base != nil {
+		base.inflight.remove(keyOf(batchMsg))
+	}
+	for _, ctx := range ctxs {
+		ctx.Reset()
+		this.ReleaseContext(ctx)
+	}
+}
+
+// items queued to pool run concurrently on idle workers, bounded by pool.
+// worker of batch runs items no other worker picked up yet, so batch never waits for a busy pool
+func (this *coreImpl) invokeBatchOnPool(pool *workerPool, ctxs []Context) {
+	claimed := make([]int32, len(ctxs))
+	wg := &sync.WaitGroup{}
+	wg.Add(len(ctxs))
+	invoke := func(idx int) {
+		if !atomic.CompareAndSwapInt32(&claimed[idx], 0, 1) {
+			return
+		}
+		defer wg.Done()
+		this.invokeReq(ctxs[idx])
+	}
+	// first item runs on worker of batch anyway
+	for idx := 1; idx < len(ctxs); idx++ {
+		idx := idx
+		if !pool.trySubmit(func() { invoke(idx) }) {
+			break
+		}
+	}
+	for idx := range ctxs {
+		invoke(idx)
+	}
+	wg.Wait()
+}
+
+func (this *coreImpl) handleBatch(call Callable, batchMsg *RawMsg, ctxs []Context) {
+	if ctxs == nil {
+		return
+	}
+	defer this.releaseBatch(call, batchMsg, ctxs)
+	if !batchMsg.Parallel {
+		for _, ctx := range ctxs {
+			this.invokeReq(ctx)
+		}
+	} else if pool := this.poolOf(call); pool != nil {
+		this.invokeBatchOnPool(pool, ctxs)
+	} else {
+		// items of batch run concurrently, at most kMaxBatchParallel goroutines
+		limit := len(ctxs)
+		if limit > kMaxBatchParallel {
+			limit = kMaxBatchParallel
+		}
+		sem := make(chan struct{}, limit)
+		wg := &sync.WaitGroup{}
+		wg.Add(len(ctxs))
+		for _, ctx := range ctxs {
+			sem <- struct{}{}
+			go func(ctx Context) {
+				defer func() {
+					<-sem
+					wg.Done()
+				}()
+				this.invokeReq(ctx)
+			}(ctx)
+		}
+		wg.Wait()
+	}
+	ackMsg := &RawMsg{
+		Id:         batchMsg.Id,
+		Seq:        batchMsg.Seq,
+		MethodName: batchMsg.MethodName,
+		Type:       AckMsg,
+	}
+	acks := make([]*RawMsg, 0, len(ctxs))
+	for _, ctx := range ctxs {
+		if ctx.GoContext().Err() != nil && ctx.Error() == nil {
+			ctx.SetError(ctx.GoContext().Err())
+		}
+		itemAck, err := ctx.BuildOutMsg()
+		if err != nil {
+			itemAck = &RawMsg{Type: AckMsg}
+			itemAck.SetError(err)
+		}
+		itemAck.Id = ""
+		acks = append(acks, itemAck)
+	}
+	data, err := gRpcSerialization.Marshal(acks)
+	if err != nil {
+		ackMsg.SetError(err)
+	} else {
+		ackMsg.Data = data
+	}
+	frames, err := encodeRpcFrames(ackMsg, this.maxMsgSize, encoderOf(call, ackMsg.MethodName))
+	if err == ErrMsgTooLarge {
+		ackMsg.Data = nil
+		ackMsg.SetError(err)
+		frames, err = encodeRpcFrames(ackMsg, this.maxMsgSize, encoderOf(call, ackMsg.MethodName))
+	}
+	if err != nil {
+		log.Printf("coreImpl handle BATCH Id -> %s,marshal output msg error -> %v\n", keyOf(batchMsg), err)
+		return
+	}
+	writeFrames(call.Writer(), nil, frames)
+}
@@ -0,0 +1,167 @@
+package rpcx
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+const BindDefaultTimeout = time.Second * 5
+
+type BindOptions struct {
+	Service     string        // method named `Service.Field` if set, tag name used as is
+	Timeout     time.Duration // timeout of fields without timeout tag, BindDefaultTimeout if zero
+	Headers     RpcMsgHeader  // sent with every call
+	Middlewares []MiddlewareFunc
+}
+
+// fill func fields of api with funcs calling remote method.
+// field tag `rpcx:"name,timeout=3s"` overrides method name and timeout, `rpcx:"-"` skips field.
+// supported fields: func([context.Context,] in...) ([out,] error), more than one in sent as Args,
+// calls with context.Context returns as soon as ctx done, nil ctx treated as context.Background().
+// opts could be nil, *SignatureError returned and no field set if any field is bad
+func BindClient(callable Callable, api interface{}, opts *BindOptions) error {
+	if opts == nil {
+		opts = &BindOptions{}
+	}
+	rv := reflect.ValueOf(api)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return &SignatureError{Reason: fmt.Sprintf("api must be pointer to struct, got %T", api)}
+	}
+	rv = rv.Elem()
+	rt := rv.Type()
+	binds := make(map[int]reflect.Value)
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		tag := field.Tag.Get("rpcx")
+		if field.Type.Kind() != reflect.Func || len(field.PkgPath) != 0 || tag == "-" {
+			continue
+		}
+		b, err := newBoundFunc(callable, field, tag, opts)
+		if err != nil {
+			return err
+		}
+		binds[i] = reflect.MakeFunc(field.Type, b.call)
+	}
+	for idx, fn := range binds {
+		rv.Field(idx).Set(fn)
+	}
+	return nil
+}
+
+type boundFunc struct {
+	callable  Callable
+	name      string
+	timeout   time.Duration
+	opts      *BindOptions
+	goContext bool
+	inNum     int          // in params after context
+	outType   reflect.Type // nil if func returns error only
+}
+
+func newBoundFunc(callable Callable, field reflect.StructField, tag string, opts *BindOptions) (*boundFunc, error) {
+	b := &boundFunc{
+		callable: callable,
+		name:     field.Name,
+		timeout:  opts.Timeout,
+		opts:     opts,
+	}
+	if len(opts.Service) != 0 {
+		b.name = opts.Service + "." + field.Name
+	}
+	if b.timeout <= 0 {
+		b.timeout = BindDefaultTimeout
+	}
+	elems := strings.Split(tag, ",")
+	if len(elems[0]) != 0 {
+		b.name = elems[0]
+	}
+	for _, it := range elems[1:] {
+		kv := strings.SplitN(strings.TrimSpace(it), "=", 2)
+		if len(kv) != 2 || kv[0] != "timeout" {
+			return nil, &SignatureError{Func: field.Name, Reason: fmt.Sprintf("unknown tag option `%s`", it)}
+		}
+		timeout, err := time.ParseDuration(kv[1])
+		if err != nil || timeout <= 0 {
+			return nil, &SignatureError{Func: field.Name, Reason: fmt.Sprintf("bad timeout `%s`", kv[1])}
+		}
+		b.timeout = timeout
+	}
+	t := field.Type
+	inStart := 0
+	if t.NumIn() != 0 && t.In(0) == typeOfGoContext {
+		b.goContext = true
+		inStart = 1
+	}
+	if t.IsVariadic() {
+		err := newSignatureError(fmt.Sprintf("in[%d]", t.NumIn()-1), "variadic param not supported")
+		err.Func = field.Name
+		return nil, err
+	}
+	b.inNum = t.NumIn() - inStart
+	switch {
+	case t.NumOut() == 1 && t.Out(0) == typeOfError:
+	case t.NumOut() == 2 && t.Out(1) == typeOfError && t.Out(0) != typeOfError:
+		b.outType = t.Out(0)
+	default:
+		err := newSignatureError("out", "must be (error) or (out, error)")
+		err.Func = field.Name
+		return nil, err
+	}
+	return b, nil
+}
+
+func (this *boundFunc) call(params []reflect.Value) []reflect.Value {
+	var goCtx context.Context = nil
+	if this.goContext {
+		// nil ctx treated as context.Background()
+		goCtx, _ = params[0].Interface().(context.Context)
+		if goCtx == nil {
+			goCtx = context.Background()
+		}
+		params = params[1:]
+	}
+	var in interface{} = nil
+	if this.inNum == 1 {
+		in = params[0].Interface()
+	} else if this.inNum > 1 {
+		args := make(Args, 0, len(params))
+		for _, it := range params {
+			args = append(args, it.Interface())
+		}
+		in = args
+	}
+	var out interface{} = nil
+	var outV reflect.Value
+	if this.outType != nil {
+		if this.outType.Kind() == reflect.Ptr {
+			outV = reflect.New(this.outType.Elem())
+			out = outV.Interface()
+		} else {
+			outV = reflect.New(this.outType)
+			out = outV.Interface()
+			outV = outV.Elem()
+		}
+	}
+	var err error
+	if goCtx != nil {
+		callCtx, cancel := context.WithTimeout(goCtx, this.timeout)
+		_, err = this.callable.CallContext(callCtx, this.name, this.opts.Headers, in, out, this.opts.Middlewares...)
+		cancel()
+	} else {
+		_, err = this.callable.Call6(this.timeout, this.name, this.opts.Headers, in, out, this.opts.Middlewares...)
+	}
+	errV := reflect.Zero(typeOfError)
+	if err != nil {
+		errV = reflect.ValueOf(&err).Elem()
+	}
+	if this.outType == nil {
+		return []reflect.Value{errV}
+	}
+	if err != nil {
+		outV = reflect.Zero(this.outType)
+	}
+	return []reflect.Value{outV, errV}
+}
@@ -1,6 +1,7 @@
 package rpcx
 
 import (
+	"context"
 	"github.com/gen-iot/liblpc/v2"
 	"time"
 )
@@ -24,7 +25,23 @@ type Callable interface {
 	Call5(timeout time.Duration, name string, in, out interface{}, mids ...MiddlewareFunc) error
 	Call6(timeout time.Duration, name string, headers RpcMsgHeader, in, out interface{}, mids ...MiddlewareFunc) (ackHeader RpcMsgHeader, err error)
 
+	// returns as soon as goCtx done
+	CallContext(goCtx context.Context, name string, headers RpcMsgHeader, in, out interface{}, mids ...MiddlewareFunc) (ackHeader RpcMsgHeader, err error)
+
+	// never block, collect results by select on future.Done(), WaitAll or future.OnDone
+	CallAsync(timeout time.Duration, name string, headers RpcMsgHeader, in, out interface{}, mids ...MiddlewareFunc) *CallFuture
+
+	// one-way notification, no ack will be sent by callee
+	Notify(name string, headers RpcMsgHeader, in interface{}, mids ...MiddlewareFunc) error
+
+	// collect many calls and send them in one round trip
+	Batch() *Batch
+
+	// open stream to callee stream func, goCtx controls stream lifetime
+	OpenStream(goCtx context.Context, name string, headers RpcMsgHeader) (ClientStream, error)
+
 	Perform(timeout time.Duration, ctx Context)
+	PerformContext(goCtx context.Context, ctx Context)
 
 	SetOnReady(cb CallableCallback)
 	SetOnClose(cb CallableCallback)
@@ -34,4 +51,29 @@ type Callable interface {
 	NotifyTimeWheel()
 
 	Writer() Writer
+
+	// protocol level keepalive, dead peer will be closed after maxMiss intervals
+	SetHeartbeat(interval time.Duration, maxMiss int)
+	// round trip time measured by heartbeat
+	RTT() time.Duration
+
+	// exchange PeerInfo before ready, must be invoked before Start
+	SetHandshake(opts *HandshakeOptions)
+	// info announced by peer during handshake, nil if unknown
+	Peer() *PeerInfo
+	// wire framing used to send msgs to peer
+	Framing() int
+
+	// invoked after each bad frame received
+	SetOnProtocolError(cb ProtocolErrorCallback)
+	// callable will be closed after n bad frames received, 0 means never close
+	SetMaxProtocolErrors(n int)
+	ProtocolErrors() uint64
+
+	// speak JSON-RPC 2.0 instead of rpcx frames, must be invoked before Start
+	SetJsonRpc(framing JsonRpcFraming)
+
+	// own worker pool instead of core pool, see Core.SetWorkerPool
+	SetWorkerPool(opts *WorkerPoolOptions)
+	WorkerPoolStats() *WorkerPoolStats
 }
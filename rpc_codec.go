@@ -0,0 +1,108 @@
+package rpcx
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"github.com/gen-iot/std"
+	"sort"
+	"sync"
+)
+
+// payload serialization, codec name will be recorded in msg,
+// so that peers use different codec could talk to the same core
+type Codec interface {
+	std.Serialization
+	Name() string
+}
+
+const (
+	CodecMsgPack = "msgpack"
+	CodecJson    = "json"
+	CodecGob     = "gob"
+	CodecJsonRpc = "jsonrpc" // json, positional params of JSON-RPC accepted
+)
+
+type namedCodec struct {
+	std.Serialization
+	name string
+}
+
+func (this *namedCodec) Name() string {
+	return this.name
+}
+
+func NewCodec(name string, serialization std.Serialization) Codec {
+	std.Assert(len(name) != 0, "codec name is empty")
+	std.Assert(serialization != nil, "serialization is nil")
+	return &namedCodec{
+		Serialization: serialization,
+		name:          name,
+	}
+}
+
+type gobSerialization struct {
+}
+
+func (this *gobSerialization) Marshal(v interface{}) ([]byte, error) {
+	buffer := &bytes.Buffer{}
+	err := gob.NewEncoder(buffer).Encode(v)
+	return buffer.Bytes(), err
+}
+
+func (this *gobSerialization) UnMarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+var MsgPackCodec = NewCodec(CodecMsgPack, std.MsgPackSerialization)
+var JsonCodec = NewCodec(CodecJson, std.JsonSerialization)
+var GobCodec = NewCodec(CodecGob, &gobSerialization{})
+var JsonRpcCodec = NewCodec(CodecJsonRpc, &jsonRpcSerialization{})
+
+var gCodecs = map[string]Codec{
+	CodecMsgPack: MsgPackCodec,
+	CodecJson:    JsonCodec,
+	CodecGob:     GobCodec,
+	CodecJsonRpc: JsonRpcCodec,
+}
+var gCodecsLock = &sync.RWMutex{}
+
+// register custom codec, codec with same name will be replaced
+func RegisterCodec(codec Codec) {
+	std.Assert(codec != nil, "codec is nil")
+	gCodecsLock.Lock()
+	defer gCodecsLock.Unlock()
+	gCodecs[codec.Name()] = codec
+}
+
+// empty name means msgpack, return nil if not found
+func GetCodec(name string) Codec {
+	if len(name) == 0 {
+		return MsgPackCodec
+	}
+	gCodecsLock.RLock()
+	defer gCodecsLock.RUnlock()
+	return gCodecs[name]
+}
+
+// names of all registered codecs, sorted
+func codecNames() []string {
+	gCodecsLock.RLock()
+	defer gCodecsLock.RUnlock()
+	out := make([]string, 0, len(gCodecs))
+	for name := range gCodecs {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+var ErrUnsupportedCodec = errors.New("unsupported codec")
+
+// msgpack is default codec, omit it in msg
+func codecName(codec Codec) string {
+	if codec == nil || codec.Name() == CodecMsgPack {
+		return ""
+	}
+	return codec.Name()
+}
@@ -0,0 +1,283 @@
+package rpcx
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"github.com/gen-iot/std"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"sort"
+	"sync"
+)
+
+// compress frame body, compressor name will be recorded in frame,
+// only used if peer announced it during handshake and v3 framing negotiated
+type Compressor interface {
+	Name() string
+	NewWriter(w io.Writer) (io.WriteCloser, error)
+	NewReader(r io.Reader) (io.ReadCloser, error)
+}
+
+const (
+	CompressDeflate = "deflate"
+	CompressGzip    = "gzip"
+)
+
+// body smaller than threshold won't be compressed
+const DefaultCompressThreshold = 1024
+
+type deflateCompressor struct {
+}
+
+func (this *deflateCompressor) Name() string {
+	return CompressDeflate
+}
+
+func (this *deflateCompressor) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return flate.NewWriter(w, flate.DefaultCompression)
+}
+
+func (this *deflateCompressor) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return flate.NewReader(r), nil
+}
+
+type gzipCompressor struct {
+}
+
+func (this *gzipCompressor) Name() string {
+	return CompressGzip
+}
+
+func (this *gzipCompressor) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return gzip.NewWriter(w), nil
+}
+
+func (this *gzipCompressor) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+var DeflateCompressor Compressor = &deflateCompressor{}
+var GzipCompressor Compressor = &gzipCompressor{}
+
+var gCompressors = map[string]Compressor{
+	CompressDeflate: DeflateCompressor,
+	CompressGzip:    GzipCompressor,
+}
+var gCompressorsLock = &sync.RWMutex{}
+
+// register custom compressor, compressor with same name will be replaced
+func RegisterCompressor(compressor Compressor) {
+	std.Assert(compressor != nil, "compressor is nil")
+	std.Assert(len(compressor.Name()) != 0 && len(compressor.Name()) <= 0xFF, "invalid compressor name")
+	gCompressorsLock.Lock()
+	defer gCompressorsLock.Unlock()
+	gCompressors[compressor.Name()] = compressor
+}
+
+// return nil if not found
+func GetCompressor(name string) Compressor {
+	gCompressorsLock.RLock()
+	defer gCompressorsLock.RUnlock()
+	return gCompressors[name]
+}
+
+// names of all registered compressors, sorted
+func compressorNames() []string {
+	gCompressorsLock.RLock()
+	defer gCompressorsLock.RUnlock()
+	out := make([]string, 0, len(gCompressors))
+	for name := range gCompressors {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+var ErrUnsupportedCompression = errors.New("unsupported compression")
+
+type CompressionOptions struct {
+	// name of registered compressor
+	Name string
+	// body smaller than threshold won't be compressed, DefaultCompressThreshold if not set
+	Threshold int
+}
+
+func (this *CompressionOptions) threshold() int {
+	if this.Threshold <= 0 {
+		return DefaultCompressThreshold
+	}
+	return this.Threshold
+}
+
+// compression of core and per method, method options override core options
+type compressionConfig struct {
+	core    *CompressionOptions
+	methods map[string]*CompressionOptions
+	lock    *sync.RWMutex
+}
+
+func newCompressionConfig() *compressionConfig {
+	return &compressionConfig{
+		methods: make(map[string]*CompressionOptions),
+		lock:    &sync.RWMutex{},
+	}
+}
+
+func (this *compressionConfig) set(opts *CompressionOptions) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.core = opts
+}
+
+func (this *compressionConfig) setMethod(method string, opts *CompressionOptions) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.methods[method] = opts
+}
+
+func (this *compressionConfig) of(method string) *CompressionOptions {
+	this.lock.RLock()
+	defer this.lock.RUnlock()
+	if opts, ok := this.methods[method]; ok {
+		return opts
+	}
+	return this.core
+}
+
+// COMPRESSED BODY: |NAME_LEN 1|NAME N|COMPRESSED DATA|
+func compressBody(compressor Compressor, data []byte) ([]byte, error) {
+	name := compressor.Name()
+	buffer := &bytes.Buffer{}
+	buffer.WriteByte(uint8(len(name)))
+	buffer.WriteString(name)
+	writer, err := compressor.NewWriter(buffer)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = writer.Write(data); err != nil {
+		return nil, err
+	}
+	if err = writer.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// decompressed body larger than maxLen will be treated as error
+func decompressBody(data []byte, maxLen int) ([]byte, error) {
+	if len(data) < 1 || len(data) < 1+int(data[0]) {
+		return nil, ErrUnsupportedCompression
+	}
+	name := string(data[1 : 1+int(data[0])])
+	compressor := GetCompressor(name)
+	if compressor == nil {
+		return nil, ErrUnsupportedCompression
+	}
+	reader, err := compressor.NewReader(bytes.NewReader(data[1+int(data[0]):]))
+	if err != nil {
+		return nil, err
+	}
+	defer std.CloseIgnoreErr(reader)
+	out, err := ioutil.ReadAll(io.LimitReader(reader, int64(maxLen)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(out) > maxLen {
+		return nil, ErrMsgTooLarge
+	}
+	return out, nil
+}
+
+// max body len of single frame, msgs larger than it could only be sent as fragments.
+// same as legacy limit, so that peers without max msg size announced accept it
+const kMaxFrameBodyLen = 1024 * 1024 * 32
+
+// how msgs are framed for one peer
+type frameEncoder struct {
+	framing    int
+	compressor Compressor
+	threshold  int
+	checksum   bool
+	jsonRpc    *jsonRpcWire // msgs translated to JSON-RPC if set
+	fragment   bool         // peer reassembles fragments
+	peerMax    int          // max msg size accepted by peer, 0 if unknown
+}
+
+// max msg size could be sent to peer as single frame
+func (this frameEncoder) peerMaxFrameLen() int {
+	if this.peerMax <= 0 || this.peerMax > kMaxFrameBodyLen {
+		return kMaxFrameBodyLen
+	}
+	return this.peerMax
+}
+
+func (this frameEncoder) encodeFrame(datas []byte, kind MsgType) ([]byte, error) {
+	if this.framing != FramingV3 {
+		return encodeFrame(datas, this.framing, kind, 0), nil
+	}
+	var flags FrameFlags = 0
+	if this.compressor != nil && len(datas) >= this.threshold {
+		compressed, err := compressBody(this.compressor, datas)
+		if err != nil {
+			return nil, err
+		}
+		// not worth it if larger
+		if len(compressed) < len(datas) {
+			datas = compressed
+			flags |= FrameFlagCompressed
+		}
+	}
+	if this.checksum {
+		sum := std.UInt32ToArrBE(crc32.ChecksumIEEE(datas))
+		datas = append(datas[:len(datas):len(datas)], sum...)
+		flags |= FrameFlagChecksum
+	}
+	return encodeFrame(datas, this.framing, kind, flags), nil
+}
+
+func (this *coreImpl) SetCompression(opts *CompressionOptions) {
+	this.compression.set(opts)
+}
+
+func (this *coreImpl) SetMethodCompression(method string, opts *CompressionOptions) {
+	this.compression.setMethod(method, opts)
+}
+
+func (this *coreImpl) Compression(method string) *CompressionOptions {
+	return this.compression.of(method)
+}
+
+// compress, checksum or fragment only if peer supports it
+func (this *BaseCallable) frameEncoder(method string) frameEncoder {
+	enc := frameEncoder{
+		framing: this.Framing(),
+		jsonRpc: this.jsonRpc,
+	}
+	peer := this.Peer()
+	if enc.jsonRpc != nil || peer == nil {
+		return enc
+	}
+	enc.fragment = peer.Supports(FeatureFragment)
+	enc.peerMax = peer.MaxMsgSize
+	if enc.framing != FramingV3 {
+		return enc
+	}
+	enc.checksum = this.core.Checksum() && peer.Supports(FeatureChecksum)
+	opts := this.core.Compression(method)
+	if opts == nil || !peer.SupportsCompression(opts.Name) {
+		return enc
+	}
+	enc.compressor = GetCompressor(opts.Name)
+	enc.threshold = opts.threshold()
+	return enc
+}
+
+func encoderOf(call Callable, method string) frameEncoder {
+	if base := baseOf(call); base != nil {
+		return base.frameEncoder(method)
+	}
+	return frameEncoder{framing: FramingV2}
+}
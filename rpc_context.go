@@ -1,9 +1,11 @@
 package rpcx
 
 import (
+	"context"
 	"github.com/gen-iot/liblpc/v2"
 	"github.com/gen-iot/std"
 	"reflect"
+	"time"
 )
 
 type Context interface {
@@ -43,6 +45,10 @@ type Context interface {
 	FuncDesc() FuncDesc
 	SetFuncDesc(desc FuncDesc)
 
+	// payload codec of request, callee ack with the same codec
+	SetCodec(codec Codec)
+	Codec() Codec
+
 	SetError(err error)
 	Error() error
 
@@ -51,6 +57,13 @@ type Context interface {
 
 	AddDefer(deferFunc func())
 
+	// caller side: context passed to CallContext
+	// callee side: bound to caller deadline , canceled when caller gave up or callable closed
+	SetGoContext(goCtx context.Context)
+	GoContext() context.Context
+	Deadline() (deadline time.Time, ok bool)
+	Done() <-chan struct{}
+
 	Reset()
 
 	Init(call Callable, inMsg *RawMsg)
@@ -72,6 +85,10 @@ type contextImpl struct {
 	ackMsg        *RawMsg
 	localFnDesc   FuncDesc
 	deferFuncList []func()
+	goCtx         context.Context
+	goCtxCancel   context.CancelFunc
+	stream        Stream
+	issued        bool // caller side, request issued by local
 	liblpc.BaseUserData
 }
 
@@ -89,6 +106,13 @@ func (this *contextImpl) Reset() {
 	this.ackMsg = nil
 	this.localFnDesc = 0
 	this.writer = nil
+	if this.goCtxCancel != nil {
+		this.goCtxCancel()
+	}
+	this.goCtx = nil
+	this.goCtxCancel = nil
+	this.stream = nil
+	this.issued = false
 	this.SetUserData(nil)
 	this.deferFuncList = this.deferFuncList[:0]
 }
@@ -129,7 +153,11 @@ func (this *contextImpl) SetMethod(method string) {
 	this.reqMsg.MethodName = method
 }
 
+// id of compact msg built on demand, only its seq is sent
 func (this *contextImpl) Id() string {
+	if base := baseOf(this.call); base != nil {
+		return base.msgIdOf(this.reqMsg, this.issued)
+	}
 	return this.reqMsg.Id
 }
 
@@ -197,10 +225,12 @@ func (this *contextImpl) Init(call Callable, inMsg *RawMsg) {
 	this.writer = call.Writer()
 	this.reqMsg = inMsg
 	this.ackMsg = &RawMsg{
-		Id:         this.Id(),
+		Id:         inMsg.Id,
+		Seq:        inMsg.Seq,
 		MethodName: this.Method(),
 		Type:       AckMsg,
 		Headers:    RpcMsgHeader{},
+		Codec:      inMsg.Codec,
 	}
 	this.localFnDesc = 0
 	if this.deferFuncList != nil {
@@ -239,3 +269,46 @@ func (this *contextImpl) AckMsg() *RawMsg {
 func (this *contextImpl) SetAckMsg(msg *RawMsg) {
 	this.ackMsg = msg
 }
+
+func (this *contextImpl) SetGoContext(goCtx context.Context) {
+	this.goCtx = goCtx
+}
+
+func (this *contextImpl) GoContext() context.Context {
+	if this.goCtx == nil {
+		return context.Background()
+	}
+	return this.goCtx
+}
+
+func (this *contextImpl) Deadline() (deadline time.Time, ok bool) {
+	return this.GoContext().Deadline()
+}
+
+func (this *contextImpl) Done() <-chan struct{} {
+	return this.GoContext().Done()
+}
+
+// bind goCtx to request deadline, return cancel func
+func (this *contextImpl) initGoContext() context.CancelFunc {
+	if this.reqMsg.Timeout > 0 {
+		this.goCtx, this.goCtxCancel = context.WithTimeout(context.Background(),
+			time.Duration(this.reqMsg.Timeout)*time.Millisecond)
+	} else {
+		this.goCtx, this.goCtxCancel = context.WithCancel(context.Background())
+	}
+	return this.goCtxCancel
+}
+
+func (this *contextImpl) SetCodec(codec Codec) {
+	std.Assert(codec != nil, "codec is nil")
+	this.reqMsg.Codec = codecName(codec)
+	this.ackMsg.Codec = this.reqMsg.Codec
+	if this.in != nil {
+		_ = this.reqMsg.SetData(this.in)
+	}
+}
+
+func (this *contextImpl) Codec() Codec {
+	return GetCodec(this.reqMsg.Codec)
+}
@@ -0,0 +1,155 @@
+package rpcx
+
+import (
+	"github.com/gen-iot/std"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// reserved method lists registered methods, registered by Core.EnableDescribe
+const DescribeMethod = "rpcx.Describe"
+
+// machine readable schema of param or result type
+type TypeSchema struct {
+	Kind     string         `json:"kind"`               // reflect kind, e.g. struct, slice, string
+	Type     string         `json:"type"`               // go type, e.g. []string, main.Device
+	Nullable bool           `json:"nullable,omitempty"` // pointer
+	Elem     *TypeSchema    `json:"elem,omitempty"`     // slice, array and map value
+	Key      *TypeSchema    `json:"key,omitempty"`      // map key
+	Fields   []*FieldSchema `json:"fields,omitempty"`   // struct
+	Ref      string         `json:"ref,omitempty"`      // recursive struct, fields see outer schema of type
+}
+
+type FieldSchema struct {
+	Name      string      `json:"name"`                // go field name
+	Json      string      `json:"json"`                // key in json
+	MsgPack   string      `json:"msgpack"`             // key in msgpack
+	OmitEmpty bool        `json:"omitEmpty,omitempty"` // json omitempty
+	Embedded  bool        `json:"embedded,omitempty"`  // anonymous field, fields flattened by json
+	Validate  string      `json:"validate,omitempty"`  // validation tag
+	Schema    *TypeSchema `json:"schema"`
+}
+
+type MethodSchema struct {
+	Name         string        `json:"name"`
+	Params       []*TypeSchema `json:"params"`           // params after context, encoded as array if more than one
+	Result       *TypeSchema   `json:"result,omitempty"` // nil if method has no result
+	Stream       bool          `json:"stream,omitempty"`
+	GoContext    bool          `json:"goContext,omitempty"` // first param is context.Context
+	ReturnsError bool          `json:"returnsError"`
+}
+
+// register DescribeMethod which returns []*MethodSchema of all registered methods sorted by name,
+// m applied on it, e.g. auth middlewares. invoke again to replace m
+func (this *coreImpl) EnableDescribe(m ...MiddlewareFunc) {
+	fn, err := this.buildFunc(DescribeMethod, func(ctx Context) ([]*MethodSchema, error) {
+		return this.Describe(), nil
+	}, m...)
+	std.AssertError(err, "reg describe func")
+	this.addFunc(fn)
+}
+
+// schemas of all registered methods sorted by name
+func (this *coreImpl) Describe() []*MethodSchema {
+	this.lock.RLock()
+	fns := make([]*rpcFunc, 0, len(this.rcpFuncMap))
+	for _, fn := range this.rcpFuncMap {
+		fns = append(fns, fn)
+	}
+	this.lock.RUnlock()
+	sort.Slice(fns, func(i, j int) bool {
+		return fns[i].name < fns[j].name
+	})
+	out := make([]*MethodSchema, 0, len(fns))
+	for _, fn := range fns {
+		out = append(out, fn.schema())
+	}
+	return out
+}
+
+func (this *rpcFunc) schema() *MethodSchema {
+	out := &MethodSchema{
+		Name:         this.name,
+		Params:       make([]*TypeSchema, 0, len(this.inParamTypes)),
+		Stream:       this.handleFuncDesc&ReqStream != 0,
+		GoContext:    this.handleFuncDesc&ReqGoContext != 0,
+		ReturnsError: this.outErrIdx != -1,
+	}
+	if !out.Stream {
+		for _, t := range this.inParamTypes {
+			out.Params = append(out.Params, schemaOf(t, map[reflect.Type]bool{}))
+		}
+	}
+	if this.outParamType != nil {
+		out.Result = schemaOf(this.outParamType, map[reflect.Type]bool{})
+	}
+	return out
+}
+
+// visiting holds structs of current path, so that recursive types end with Ref
+func schemaOf(t reflect.Type, visiting map[reflect.Type]bool) *TypeSchema {
+	out := &TypeSchema{
+		Type: t.String(),
+	}
+	for t.Kind() == reflect.Ptr {
+		out.Nullable = true
+		t = t.Elem()
+	}
+	out.Kind = t.Kind().String()
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array:
+		out.Elem = schemaOf(t.Elem(), visiting)
+	case reflect.Map:
+		out.Key = schemaOf(t.Key(), visiting)
+		out.Elem = schemaOf(t.Elem(), visiting)
+	case reflect.Struct:
+		if visiting[t] {
+			out.Ref = t.String()
+			return out
+		}
+		visiting[t] = true
+		out.Fields = fieldsOf(t, visiting)
+		delete(visiting, t)
+	}
+	return out
+}
+
+func fieldsOf(t reflect.Type, visiting map[reflect.Type]bool) []*FieldSchema {
+	fields := make([]*FieldSchema, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if len(field.PkgPath) != 0 && !field.Anonymous {
+			continue // unexported
+		}
+		jsonName, jsonOpts := parseTag(field.Tag.Get("json"))
+		if jsonName == "-" && len(jsonOpts) == 0 {
+			continue
+		}
+		if len(jsonName) == 0 {
+			jsonName = field.Name
+		}
+		// msgpack tag preferred, json tag used if not set
+		msgpackName, _ := parseTag(field.Tag.Get("msgpack"))
+		if len(msgpackName) == 0 {
+			msgpackName = jsonName
+		}
+		fields = append(fields, &FieldSchema{
+			Name:      field.Name,
+			Json:      jsonName,
+			MsgPack:   msgpackName,
+			OmitEmpty: strings.Contains(jsonOpts, "omitempty"),
+			Embedded:  field.Anonymous,
+			Validate:  field.Tag.Get("validate"),
+			Schema:    schemaOf(field.Type, visiting),
+		})
+	}
+	return fields
+}
+
+func parseTag(tag string) (name string, opts string) {
+	if idx := strings.Index(tag, ","); idx != -1 {
+		return tag[:idx], tag[idx+1:]
+	}
+	return tag, ""
+}
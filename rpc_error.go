@@ -0,0 +1,162 @@
+package rpcx
+
+import (
+	"context"
+	"errors"
+	"github.com/gen-iot/std"
+	"sync"
+)
+
+type ErrorCode int
+
+// built-in codes, business codes should start from CodeUserDefined
+const (
+	CodeUnknown ErrorCode = iota + 1
+	CodeFuncNotFound
+	CodeInParamNil
+	CodeInvokeFailed
+	CodeValidationFailed
+	CodeTimeout
+	CodeCanceled
+	CodeUnsupportedCodec
+	CodeCallableClosed
+	CodeMsgTooLarge
+	CodeHandshakeRejected
+	CodeHandshakeRequired
+	CodeInvalidParams
+	CodeBusy
+)
+
+const CodeUserDefined ErrorCode = 1000
+
+var ErrValidationFailed = errors.New("validation failed")
+var ErrInvalidParams = errors.New("invalid params")
+
+// structured error transferred between caller and callee,
+// errors.Is(err, sentinel) works if sentinel registered by RegisterErrorCode
+type Error struct {
+	Code      ErrorCode         `json:"code"`
+	Message   string            `json:"message"`
+	Details   map[string]string `json:"details,omitempty"`
+	Retryable bool              `json:"retryable,omitempty"`
+}
+
+func NewError(code ErrorCode, msg string) *Error {
+	return &Error{
+		Code:    code,
+		Message: msg,
+	}
+}
+
+func (this *Error) Error() string {
+	return this.Message
+}
+
+func (this *Error) WithDetail(key, value string) *Error {
+	if this.Details == nil {
+		this.Details = make(map[string]string)
+	}
+	this.Details[key] = value
+	return this
+}
+
+func (this *Error) WithRetryable(retryable bool) *Error {
+	this.Retryable = retryable
+	return this
+}
+
+// *Error with same code matches
+func (this *Error) Is(target error) bool {
+	if e, ok := target.(*Error); ok {
+		return e.Code == this.Code
+	}
+	return false
+}
+
+// registered sentinel of code
+func (this *Error) Unwrap() error {
+	return errorOfCode(this.Code)
+}
+
+type registeredError struct {
+	code     ErrorCode
+	sentinel error
+}
+
+// ordered by registration, so that code of error wraps many sentinels is stable
+type errorRegistry struct {
+	codes []registeredError
+	lock  *sync.RWMutex
+}
+
+var gErrorRegistry = &errorRegistry{
+	codes: make([]registeredError, 0),
+	lock:  &sync.RWMutex{},
+}
+
+// map code to sentinel/typed error,
+// callee returns sentinel will be sent as code, caller receives code will unwrap to sentinel.
+// if error wraps many sentinels, code registered first wins. register code again replaces its sentinel
+func RegisterErrorCode(code ErrorCode, sentinel error) {
+	std.Assert(sentinel != nil, "sentinel is nil")
+	gErrorRegistry.lock.Lock()
+	defer gErrorRegistry.lock.Unlock()
+	for idx := range gErrorRegistry.codes {
+		if gErrorRegistry.codes[idx].code == code {
+			gErrorRegistry.codes[idx].sentinel = sentinel
+			return
+		}
+	}
+	gErrorRegistry.codes = append(gErrorRegistry.codes, registeredError{code: code, sentinel: sentinel})
+}
+
+func errorOfCode(code ErrorCode) error {
+	gErrorRegistry.lock.RLock()
+	defer gErrorRegistry.lock.RUnlock()
+	for _, it := range gErrorRegistry.codes {
+		if it.code == code {
+			return it.sentinel
+		}
+	}
+	return nil
+}
+
+func codeOfError(err error) (ErrorCode, bool) {
+	gErrorRegistry.lock.RLock()
+	defer gErrorRegistry.lock.RUnlock()
+	for _, it := range gErrorRegistry.codes {
+		if errors.Is(err, it.sentinel) {
+			return it.code, true
+		}
+	}
+	return CodeUnknown, false
+}
+
+// convert any error to *Error
+func AsError(err error) *Error {
+	if err == nil {
+		return nil
+	}
+	var rpcErr *Error = nil
+	if errors.As(err, &rpcErr) {
+		return rpcErr
+	}
+	code, _ := codeOfError(err)
+	return NewError(code, err.Error())
+}
+
+func init() {
+	RegisterErrorCode(CodeFuncNotFound, ErrFuncNotFound)
+	RegisterErrorCode(CodeInParamNil, ErrInParamNil)
+	RegisterErrorCode(CodeInvokeFailed, ErrInvokeFailed)
+	RegisterErrorCode(CodeValidationFailed, ErrValidationFailed)
+	RegisterErrorCode(CodeTimeout, context.DeadlineExceeded)
+	RegisterErrorCode(CodeCanceled, context.Canceled)
+	RegisterErrorCode(CodeUnsupportedCodec, ErrUnsupportedCodec)
+	RegisterErrorCode(CodeCallableClosed, ErrCallableClosed)
+	RegisterErrorCode(CodeMsgTooLarge, ErrMsgTooLarge)
+	RegisterErrorCode(CodeHandshakeRejected, ErrHandshakeRejected)
+	RegisterErrorCode(CodeHandshakeRequired, ErrHandshakeRequired)
+	RegisterErrorCode(CodeBusy, ErrBusy)
+	RegisterErrorCode(CodeInvalidParams, ErrInvalidParams)
+}
@@ -0,0 +1,69 @@
+package rpcx
+
+import (
+	"errors"
+	"github.com/gen-iot/std"
+	"testing"
+)
+
+var errDeviceOffline = errors.New("device offline")
+
+const codeDeviceOffline = CodeUserDefined + 1
+
+func TestStructuredError(t *testing.T) {
+	RegisterErrorCode(codeDeviceOffline, errDeviceOffline)
+	cases := []struct {
+		err  error
+		code ErrorCode
+	}{
+		{ErrFuncNotFound, CodeFuncNotFound},
+		{ErrInParamNil, CodeInParamNil},
+		{errDeviceOffline, codeDeviceOffline},
+		{NewError(CodeValidationFailed, "name required").WithDetail("field", "name"), CodeValidationFailed},
+		{errors.New("some business error"), CodeUnknown},
+	}
+	for _, it := range cases {
+		msg := &RawMsg{
+			Id:   std.GenRandomUUID(),
+			Type: AckMsg,
+		}
+		msg.SetError(it.err)
+		bytes, err := encodeRpcMsg(msg)
+		std.AssertError(err, "encodeRpcMsg")
+		buffer := std.NewByteBuffer()
+		buffer.Write(bytes)
+		outMsg, err := decodeRpcMsg(buffer, 1024*1024*4)
+		std.AssertError(err, "decodeRpcMsg")
+		remoteErr := outMsg.GetError()
+		std.Assert(remoteErr.Error() == it.err.Error(), "error message mismatched")
+		rpcErr := AsError(remoteErr)
+		std.Assert(rpcErr.Code == it.code, "error code mismatched")
+		if it.code != CodeUnknown {
+			std.Assert(errors.Is(remoteErr, it.err) || errors.Is(remoteErr, NewError(it.code, "")),
+				"errors.Is mismatched")
+		}
+	}
+	remoteErr := AsError(ErrFuncNotFound)
+	std.Assert(errors.Is(remoteErr, ErrFuncNotFound), "should unwrap to sentinel")
+	std.Assert(errors.Is(NewError(CodeValidationFailed, "x"), ErrValidationFailed), "should unwrap to sentinel")
+}
+
+type multiError []error
+
+func (this multiError) Error() string {
+	return "multi error"
+}
+
+func (this multiError) Unwrap() []error {
+	return this
+}
+
+func TestErrorCodeStable(t *testing.T) {
+	RegisterErrorCode(codeDeviceOffline, errDeviceOffline)
+	// wraps two registered sentinels, code registered first wins
+	err := multiError{errDeviceOffline, ErrFuncNotFound}
+	for i := 0; i < 100; i++ {
+		code, ok := codeOfError(err)
+		std.Assert(ok && code == CodeFuncNotFound, "code should be stable")
+	}
+}
@@ -2,6 +2,7 @@ package rpcx
 
 import (
 	"errors"
+	"fmt"
 	"log"
 	"reflect"
 )
@@ -9,26 +10,73 @@ import (
 type FuncDesc uint8
 
 const (
-	ReqHasData FuncDesc = 0x01
-	RspHasData FuncDesc = 0x02
+	ReqHasData   FuncDesc = 0x01
+	RspHasData   FuncDesc = 0x02
+	ReqStream    FuncDesc = 0x04 // in param is rpcx.Stream
+	ReqGoContext FuncDesc = 0x08 // first in param is context.Context
+	ReqMultiArgs FuncDesc = 0x10 // more than one in params, request is Args
 )
 
+// positional params of func with multiple in params, encoded as array.
+// e.g. Call5(timeout, "add", rpcx.Args{1, 2}, &out)
+type Args []interface{}
+
 type rpcFunc struct {
 	name           string
 	fun            reflect.Value
-	inParamType    reflect.Type
+	inParamType    reflect.Type   // Args if ReqMultiArgs
+	inParamTypes   []reflect.Type // in params after context
 	outParamType   reflect.Type
+	outErrIdx      int // -1 if func returns no error
 	mid            middleware
 	handleFunc     HandleFunc
 	handleFuncDesc FuncDesc
 }
 
-func (this *rpcFunc) decodeInParam(data []byte) (interface{}, error) {
+// check signature of fv, m applied on func only
+func newRpcFunc(fname string, fv reflect.Value, m ...MiddlewareFunc) (*rpcFunc, error) {
+	fvType := fv.Type()
+	//check in/out param
+	inParamTypes, inParamDesc, err := checkInParam(fvType)
+	if err != nil {
+		err.(*SignatureError).Func = fname
+		return nil, err
+	}
+	outParamType, outParamDesc, outErrIdx, err := checkOutParam(fvType)
+	if err != nil {
+		err.(*SignatureError).Func = fname
+		return nil, err
+	}
+	var inParamType reflect.Type = nil
+	if inParamDesc&ReqMultiArgs != 0 {
+		inParamType = typeOfArgs
+	} else if len(inParamTypes) == 1 {
+		inParamType = inParamTypes[0]
+	}
+	fn := &rpcFunc{
+		name:           fname,
+		fun:            fv,
+		inParamType:    inParamType,
+		inParamTypes:   inParamTypes,
+		outParamType:   outParamType,
+		outErrIdx:      outErrIdx,
+		handleFuncDesc: inParamDesc | outParamDesc,
+	}
+	fn.mid.Use(m...)
+	fn.handleFunc = fn.mid.buildChain(fn.____invoke)
+	return fn, nil
+}
+
+func (this *rpcFunc) decodeInParam(msg *RawMsg) (interface{}, error) {
+	data := msg.Data
 	// fastpath
 	if this.handleFuncDesc&ReqHasData == 0 {
 		// request in is nil
 		return nil, nil
 	}
+	if this.handleFuncDesc&ReqMultiArgs != 0 {
+		return this.decodeArgs(msg)
+	}
 	// check reqHasData
 	if len(data) == 0 {
 		return reflect.Zero(this.inParamType).Interface(), nil
@@ -41,9 +89,9 @@ func (this *rpcFunc) decodeInParam(data []byte) (interface{}, error) {
 	}
 	newOutValue := reflect.New(elementType)
 	newOut := newOutValue.Interface()
-	err := gRpcSerialization.UnMarshal(data, newOut)
+	err := msg.BindData(newOut)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w: %v", ErrInvalidParams, err)
 	}
 	if !isPtr {
 		newOut = newOutValue.Elem().Interface()
@@ -51,8 +99,31 @@ func (this *rpcFunc) decodeInParam(data []byte) (interface{}, error) {
 	return newOut, nil
 }
 
-var errInvokeErr = errors.New("invoke failed")
-var errInParamNil = errors.New("inParam is nil")
+// decode array into params one by one
+func (this *rpcFunc) decodeArgs(msg *RawMsg) (interface{}, error) {
+	ptrs := make([]interface{}, 0, len(this.inParamTypes))
+	for _, t := range this.inParamTypes {
+		ptrs = append(ptrs, reflect.New(t).Interface())
+	}
+	if len(msg.Data) != 0 {
+		decoded := append([]interface{}{}, ptrs...)
+		err := msg.BindData(&decoded)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidParams, err)
+		}
+		if len(decoded) != len(ptrs) {
+			return nil, fmt.Errorf("%w: want %d params, got %d", ErrInvalidParams, len(ptrs), len(decoded))
+		}
+	}
+	args := make(Args, 0, len(ptrs))
+	for _, ptr := range ptrs {
+		args = append(args, reflect.ValueOf(ptr).Elem().Interface())
+	}
+	return args, nil
+}
+
+var ErrInvokeFailed = errors.New("invoke failed")
+var ErrInParamNil = errors.New("inParam is nil")
 
 // dont call this func directly
 func (this *rpcFunc) ____invoke(c Context) {
@@ -68,39 +139,51 @@ func (this *rpcFunc) ____invoke(c Context) {
 			panic(panicErr)
 		}
 		log.Printf("call [%s] error:%v\n", ctx.Method(), panicErr)
-		ctx.SetError(errInvokeErr)
+		ctx.SetError(ErrInvokeFailed)
 	}()
 	err := ctx.Error()
 	if err != nil {
 		return
 	}
-	var outParam interface{} = nil
-	var paramV []reflect.Value = nil
-	if this.handleFuncDesc&ReqHasData != 0 {
+	paramV := make([]reflect.Value, 0, len(this.inParamTypes)+1)
+	if this.handleFuncDesc&ReqGoContext != 0 {
+		paramV = append(paramV, reflect.ValueOf(ctx.GoContext()))
+	} else {
+		paramV = append(paramV, reflect.ValueOf(ctx))
+	}
+	if this.handleFuncDesc&ReqStream != 0 {
+		if ctx.stream == nil {
+			ctx.SetError(errNotStreamCall)
+			return
+		}
+		paramV = append(paramV, reflect.ValueOf(ctx.stream))
+	} else if this.handleFuncDesc&ReqMultiArgs != 0 {
+		args, ok := ctx.Request().(Args)
+		if !ok || len(args) != len(this.inParamTypes) {
+			ctx.SetError(ErrInvalidParams)
+			return
+		}
+		for idx, arg := range args {
+			if arg == nil {
+				paramV = append(paramV, reflect.Zero(this.inParamTypes[idx]))
+			} else {
+				paramV = append(paramV, reflect.ValueOf(arg))
+			}
+		}
+	} else if this.handleFuncDesc&ReqHasData != 0 {
 		inParam := ctx.Request()
 		if inParam == nil {
-			ctx.SetError(errInParamNil)
+			ctx.SetError(ErrInParamNil)
 			return
 		}
-		paramV = []reflect.Value{reflect.ValueOf(ctx), reflect.ValueOf(inParam)}
-	} else {
-		paramV = []reflect.Value{reflect.ValueOf(ctx)}
+		paramV = append(paramV, reflect.ValueOf(inParam))
 	}
 	retV := this.fun.Call(paramV)
-	rspErrIdx := -1
-	rspDataIdx := -1
-	if this.handleFuncDesc&RspHasData != 0 {
-		rspErrIdx = 1
-		rspDataIdx = 0
-	} else {
-		rspErrIdx = 0
-	}
-	if !retV[rspErrIdx].IsNil() { // check error
-		err = retV[rspErrIdx].Interface().(error)
+	if this.outErrIdx != -1 && !retV[this.outErrIdx].IsNil() { // check error
+		err = retV[this.outErrIdx].Interface().(error)
 		ctx.SetError(err)
 	}
-	if rspDataIdx != -1 {
-		outParam = retV[rspDataIdx].Interface()
-		ctx.SetResponse(outParam)
+	if this.handleFuncDesc&RspHasData != 0 {
+		ctx.SetResponse(retV[0].Interface())
 	}
 }
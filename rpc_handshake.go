@@ -0,0 +1,315 @@
+package rpcx
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gen-iot/std"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const ProtocolVersion = 1
+
+const HandshakeDefaultTimeout = time.Second * 10
+
+// optional protocol features, peer announces what it supports during handshake
+const (
+	FeatureStream    = "stream"
+	FeatureFragment  = "fragment"
+	FeatureHeartbeat = "heartbeat"
+	FeatureFramingV3 = "framing.v3"
+	FeatureChecksum  = "checksum"
+	FeatureCompactId = "compact.id"
+)
+
+var gFeatures = []string{FeatureStream, FeatureFragment, FeatureHeartbeat, FeatureChecksum, FeatureCompactId}
+
+var ErrHandshakeRejected = errors.New("handshake rejected")
+var ErrHandshakeRequired = errors.New("handshake not finished")
+var ErrHandshakeTimeout = errors.New("handshake timeout")
+var ErrFeatureUnsupported = errors.New("feature not supported by peer")
+
+// identity and capabilities announced by peer
+type PeerInfo struct {
+	Id           string            `json:"id"`
+	Version      int               `json:"version"`
+	Codecs       []string          `json:"codecs"`
+	Compressions []string          `json:"compressions,omitempty"`
+	Features     []string          `json:"features,omitempty"`
+	MaxMsgSize   int               `json:"maxMsgSize,omitempty"` // 0 if peer didn't announce it
+	Credentials  map[string]string `json:"credentials,omitempty"`
+}
+
+func containsString(arr []string, s string) bool {
+	for _, it := range arr {
+		if it == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (this *PeerInfo) SupportsCodec(name string) bool {
+	if len(name) == 0 || name == CodecMsgPack {
+		return true
+	}
+	return containsString(this.Codecs, name)
+}
+
+func (this *PeerInfo) SupportsCompression(name string) bool {
+	return containsString(this.Compressions, name)
+}
+
+func (this *PeerInfo) Supports(feature string) bool {
+	return containsString(this.Features, feature)
+}
+
+type HandshakeOptions struct {
+	// identity of local side
+	PeerId      string
+	Credentials map[string]string
+	// optional, reject peer by returning error
+	Authenticate func(call Callable, peer *PeerInfo) error
+	// peer must finish handshake in time, HandshakeDefaultTimeout if not set
+	Timeout time.Duration
+}
+
+func localPeerInfo(core Core, opts *HandshakeOptions) *PeerInfo {
+	features := append([]string{}, gFeatures...)
+	if core.Framing() >= FramingV3 {
+		features = append(features, FeatureFramingV3)
+	}
+	info := &PeerInfo{
+		Version:      ProtocolVersion,
+		Codecs:       codecNames(),
+		Compressions: compressorNames(),
+		Features:     features,
+		MaxMsgSize:   core.MaxMsgSize(),
+	}
+	if opts != nil {
+		info.Id = opts.PeerId
+		info.Credentials = opts.Credentials
+	}
+	return info
+}
+
+const (
+	kHandshakePending int32 = iota
+	kHandshakeDone
+	kHandshakeFailed
+)
+
+type handshake struct {
+	opts     HandshakeOptions
+	state    int32
+	lock     *sync.Mutex
+	received bool // peer hello accepted by local
+	accepted bool // local hello accepted by peer
+	timer    *time.Timer
+}
+
+func newHandshake(opts *HandshakeOptions) *handshake {
+	hs := &handshake{
+		opts:  *opts,
+		state: kHandshakePending,
+		lock:  &sync.Mutex{},
+	}
+	if hs.opts.Timeout <= 0 {
+		hs.opts.Timeout = HandshakeDefaultTimeout
+	}
+	return hs
+}
+
+// enable handshake before ready, must be invoked before Start.
+// calls won't be sent or accepted until handshake finished
+func (this *BaseCallable) SetHandshake(opts *HandshakeOptions) {
+	if opts == nil {
+		this.handshake = nil
+		return
+	}
+	this.handshake = newHandshake(opts)
+}
+
+// info announced by peer, nil if peer never said hello
+func (this *BaseCallable) Peer() *PeerInfo {
+	peer, _ := this.peer.Load().(*PeerInfo)
+	return peer
+}
+
+// true only if peer said hello without feature, unknown peer is trusted
+func (this *BaseCallable) peerLacks(feature string) bool {
+	peer := this.Peer()
+	return peer != nil && !peer.Supports(feature)
+}
+
+func (this *BaseCallable) handshakeReady() bool {
+	return this.handshake == nil || atomic.LoadInt32(&this.handshake.state) == kHandshakeDone
+}
+
+// connection established, say hello before ready if handshake enabled
+func (this *BaseCallable) ready(err error) {
+	if err != nil || this.handshake == nil {
+		this.DoReady(err)
+		return
+	}
+	hs := this.handshake
+	hs.lock.Lock()
+	hs.timer = time.AfterFunc(hs.opts.Timeout, func() {
+		this.finishHandshake(ErrHandshakeTimeout)
+	})
+	hs.lock.Unlock()
+	if err := this.sendHello(localPeerInfo(this.core, &hs.opts)); err != nil {
+		this.finishHandshake(err)
+	}
+}
+
+func (this *BaseCallable) sendHello(info *PeerInfo) error {
+	data, err := gRpcSerialization.Marshal(info)
+	if err != nil {
+		return err
+	}
+	return this.writeHandshakeMsg(&RawMsg{
+		Id:   std.GenRandomUUID(),
+		Type: HelloMsg,
+		Data: data,
+	})
+}
+
+// tell peer whether its hello accepted
+func (this *BaseCallable) sendHelloAck(err error) error {
+	msg := &RawMsg{
+		Id:   std.GenRandomUUID(),
+		Type: HelloAckMsg,
+	}
+	msg.SetError(err)
+	return this.writeHandshakeMsg(msg)
+}
+
+func (this *BaseCallable) writeHandshakeMsg(msg *RawMsg) error {
+	std.Assert(this.writer != nil, "stream is nil!")
+	msgBytes, err := this.encodeMsg(msg)
+	if err != nil {
+		return err
+	}
+	this.writer.Write(nil, msgBytes, false)
+	return nil
+}
+
+// invoked in loop, hello accepted once, peer can't replace its identity afterwards
+func (this *BaseCallable) onHello(msg *RawMsg) {
+	hs := this.handshake
+	if (hs == nil && this.Peer() != nil) || (hs != nil && !hs.waitingHello()) {
+		log.Println("callable got hello after handshake, ignore it")
+		return
+	}
+	peer := new(PeerInfo)
+	if err := gRpcSerialization.UnMarshal(msg.Data, peer); err != nil {
+		log.Println("callable unmarshal hello error -> ", err)
+		this.finishHandshake(err)
+		return
+	}
+	if hs == nil {
+		// handshake not enabled locally, only answer peer
+		this.acceptPeer(peer)
+		err := this.sendHello(localPeerInfo(this.core, nil))
+		if err == nil {
+			err = this.sendHelloAck(nil)
+		}
+		if err != nil {
+			log.Println("callable answer hello error -> ", err)
+		}
+		return
+	}
+	if hs.opts.Authenticate != nil {
+		if err := hs.opts.Authenticate(this.delegate, peer); err != nil {
+			err = fmt.Errorf("%w: %v", ErrHandshakeRejected, err)
+			_ = this.sendHelloAck(err)
+			this.finishHandshake(err)
+			return
+		}
+	}
+	this.acceptPeer(peer)
+	if err := this.sendHelloAck(nil); err != nil {
+		this.finishHandshake(err)
+		return
+	}
+	hs.lock.Lock()
+	hs.received = true
+	hs.lock.Unlock()
+	this.tryFinishHandshake()
+}
+
+// pending and no hello accepted yet
+func (this *handshake) waitingHello() bool {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	return atomic.LoadInt32(&this.state) == kHandshakePending && !this.received
+}
+
+func (this *BaseCallable) acceptPeer(peer *PeerInfo) {
+	this.peer.Store(peer)
+	if peer.Supports(FeatureFramingV3) {
+		this.upgradeFraming(FramingV3)
+	}
+}
+
+// invoked in loop
+func (this *BaseCallable) onHelloAck(msg *RawMsg) {
+	if err := msg.GetError(); err != nil {
+		log.Println("callable handshake rejected by peer -> ", err)
+		this.finishHandshake(err)
+		return
+	}
+	hs := this.handshake
+	if hs == nil {
+		return
+	}
+	hs.lock.Lock()
+	hs.accepted = true
+	hs.lock.Unlock()
+	this.tryFinishHandshake()
+}
+
+func (this *BaseCallable) tryFinishHandshake() {
+	hs := this.handshake
+	hs.lock.Lock()
+	ok := hs.received && hs.accepted
+	hs.lock.Unlock()
+	if ok {
+		this.finishHandshake(nil)
+	}
+}
+
+// callable will be closed if handshake failed
+func (this *BaseCallable) finishHandshake(err error) {
+	hs := this.handshake
+	if hs == nil {
+		if err != nil {
+			this.core.Loop().RunInLoop(func() {
+				std.CloseIgnoreErr(this.delegate)
+			})
+		}
+		return
+	}
+	state := kHandshakeDone
+	if err != nil {
+		state = kHandshakeFailed
+	}
+	if !atomic.CompareAndSwapInt32(&hs.state, kHandshakePending, state) {
+		return
+	}
+	hs.lock.Lock()
+	if hs.timer != nil {
+		hs.timer.Stop()
+	}
+	hs.lock.Unlock()
+	this.DoReady(err)
+	if err != nil {
+		// close after queued writes, so that peer could know why
+		this.core.Loop().RunInLoop(func() {
+			std.CloseIgnoreErr(this.delegate)
+		})
+	}
+}
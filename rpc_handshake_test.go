@@ -0,0 +1,29 @@
+package rpcx
+
+import (
+	"github.com/gen-iot/std"
+	"sync/atomic"
+	"testing"
+)
+
+func TestHelloAfterHandshake(t *testing.T) {
+	core, err := New()
+	std.AssertError(err, "new rpc")
+	hello := func(id string) *RawMsg {
+		data, err := gRpcSerialization.Marshal(&PeerInfo{Id: id, Credentials: map[string]string{"token": id}})
+		std.AssertError(err, "marshal hello")
+		return &RawMsg{Type: HelloMsg, Data: data}
+	}
+	call := NewBaseCallable(core, nil, nil)
+	call.SetHandshake(&HandshakeOptions{PeerId: "local"})
+	call.peer.Store(&PeerInfo{Id: "device-1"})
+	atomic.StoreInt32(&call.handshake.state, kHandshakeDone)
+	call.onHello(hello("evil"))
+	std.Assert(call.Peer().Id == "device-1", "authenticated peer should not be replaced")
+
+	// handshake not enabled locally, first hello answered only
+	call = NewBaseCallable(core, nil, nil)
+	call.peer.Store(&PeerInfo{Id: "device-1"})
+	call.onHello(hello("evil"))
+	std.Assert(call.Peer().Id == "device-1", "peer should not be replaced")
+}
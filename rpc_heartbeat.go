@@ -0,0 +1,160 @@
+package rpcx
+
+import (
+	"errors"
+	"github.com/gen-iot/std"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var ErrHeartbeatTimeout = errors.New("heartbeat timeout, peer is dead")
+
+// ping peer every interval, callable will be closed after maxMiss intervals without any msg from peer
+type heartbeat struct {
+	interval time.Duration
+	maxMiss  int32
+	missed   int32
+	rtt      int64
+	stopC    chan struct{}
+	lock     *sync.Mutex // ping never issued after stop returned
+	stopped  bool
+}
+
+func newHeartbeat(interval time.Duration, maxMiss int) *heartbeat {
+	return &heartbeat{
+		interval: interval,
+		maxMiss:  int32(maxMiss),
+		stopC:    make(chan struct{}),
+		lock:     &sync.Mutex{},
+	}
+}
+
+// any msg from peer proves it's alive
+func (this *heartbeat) alive() {
+	atomic.StoreInt32(&this.missed, 0)
+}
+
+func (this *heartbeat) onPong(msg *RawMsg) {
+	this.alive()
+	if msg.Stamp == 0 {
+		return
+	}
+	rtt := time.Now().UnixNano() - msg.Stamp
+	if rtt < 0 {
+		rtt = 0
+	}
+	atomic.StoreInt64(&this.rtt, rtt)
+}
+
+func (this *heartbeat) RTT() time.Duration {
+	return time.Duration(atomic.LoadInt64(&this.rtt))
+}
+
+func (this *heartbeat) stop() {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if this.stopped {
+		return
+	}
+	this.stopped = true
+	close(this.stopC)
+}
+
+func (this *heartbeat) ping(call *BaseCallable) error {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if this.stopped {
+		return nil
+	}
+	return call.ping()
+}
+
+func (this *heartbeat) run(call *BaseCallable) {
+	ticker := time.NewTicker(this.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-this.stopC:
+			return
+		case <-ticker.C:
+		}
+		if call.peerLacks(FeatureHeartbeat) {
+			log.Println("callable peer doesn't support heartbeat, stop it")
+			return
+		}
+		if atomic.AddInt32(&this.missed, 1) > this.maxMiss {
+			log.Printf("callable heartbeat missed %d times, close it\n", this.maxMiss)
+			call.failPending(ErrHeartbeatTimeout)
+			std.CloseIgnoreErr(call.delegate)
+			return
+		}
+		if err := this.ping(call); err != nil {
+			log.Println("callable send ping error -> ", err)
+		}
+	}
+}
+
+// enable protocol level ping/pong, must be invoked before Start.
+// callable will be closed if peer keeps silent for more than maxMiss intervals
+func (this *BaseCallable) SetHeartbeat(interval time.Duration, maxMiss int) {
+	std.Assert(interval > 0, "heartbeat interval must > 0")
+	std.Assert(maxMiss > 0, "heartbeat maxMiss must > 0")
+	this.heartbeat = newHeartbeat(interval, maxMiss)
+}
+
+// round trip time measured by last pong, 0 if heartbeat not enabled or no pong received yet
+func (this *BaseCallable) RTT() time.Duration {
+	if this.heartbeat == nil {
+		return 0
+	}
+	return this.heartbeat.RTT()
+}
+
+func (this *BaseCallable) startHeartbeat() {
+	if this.heartbeat == nil {
+		return
+	}
+	go this.heartbeat.run(this)
+}
+
+func (this *BaseCallable) stopHeartbeat() {
+	if this.heartbeat == nil {
+		return
+	}
+	this.heartbeat.stop()
+}
+
+func (this *BaseCallable) ping() error {
+	std.Assert(this.writer != nil, "stream is nil!")
+	msgId, seq := this.nextMsgId()
+	pingBytes, err := this.encodeMsg(&RawMsg{
+		Id:    msgId,
+		Seq:   seq,
+		Type:  PingMsg,
+		Stamp: time.Now().UnixNano(),
+	})
+	if err != nil {
+		return err
+	}
+	this.writer.Write(nil, pingBytes, false)
+	return nil
+}
+
+// invoked in loop, echo stamp back so that peer could measure rtt
+func (this *BaseCallable) pong(ping *RawMsg) {
+	if this.writer == nil {
+		return
+	}
+	pongBytes, err := this.encodeMsg(&RawMsg{
+		Id:    ping.Id,
+		Seq:   ping.Seq,
+		Type:  PongMsg,
+		Stamp: ping.Stamp,
+	})
+	if err != nil {
+		return
+	}
+	this.writer.Write(nil, pongBytes, true)
+}
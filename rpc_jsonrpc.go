@@ -0,0 +1,572 @@
+package rpcx
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gen-iot/std"
+	"log"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// how JSON-RPC 2.0 messages are delimited on stream
+type JsonRpcFraming int
+
+const (
+	JsonRpcNewline       JsonRpcFraming = iota + 1 // one message per line
+	JsonRpcContentLength                           // `Content-Length: N\r\n\r\n` before each message
+)
+
+const kJsonRpcVersion = "2.0"
+
+// header section longer than it will be treated as garbage
+const kJsonRpcMaxHeaderLen = 1024
+
+const kJsonRpcContentLength = "Content-Length"
+
+var kJsonRpcHeaderEnd = []byte("\r\n\r\n")
+
+// JSON-RPC 2.0 error codes
+const (
+	jsonRpcParseError     = -32700
+	jsonRpcInvalidRequest = -32600
+	jsonRpcMethodNotFound = -32601
+	jsonRpcInvalidParams  = -32602
+	jsonRpcInternalError  = -32603
+	jsonRpcServerError    = -32000
+)
+
+var gJsonRpcCodes = map[ErrorCode]int{
+	CodeFuncNotFound:  jsonRpcMethodNotFound,
+	CodeInvalidParams: jsonRpcInvalidParams,
+	CodeInParamNil:    jsonRpcInvalidParams,
+	CodeInvokeFailed:  jsonRpcInternalError,
+}
+
+var ErrJsonRpcUnsupported = errors.New("msg type not supported by json-rpc")
+
+type jsonRpcError struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"` // *Error of rpcx peer
+}
+
+// request, notification or response
+type jsonRpcMsg struct {
+	Version string          `json:"jsonrpc"`
+	Method  *string         `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Id      json.RawMessage `json:"id,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *jsonRpcError   `json:"error,omitempty"`
+}
+
+// json, and positional params `[v]` could be bound to single in param
+type jsonRpcSerialization struct {
+}
+
+func (this *jsonRpcSerialization) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (this *jsonRpcSerialization) UnMarshal(data []byte, v interface{}) error {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || data[0] != '[' {
+		return json.Unmarshal(data, v)
+	}
+	if acceptsJsonArray(reflect.TypeOf(v)) {
+		// array itself, or array as single positional param
+		err := json.Unmarshal(data, v)
+		if err == nil || this.unmarshalPositional(data, v) != nil {
+			return err
+		}
+		return nil
+	}
+	return this.unmarshalPositional(data, v)
+}
+
+func (this *jsonRpcSerialization) unmarshalPositional(data []byte, v interface{}) error {
+	params := make([]json.RawMessage, 0)
+	if err := json.Unmarshal(data, &params); err != nil {
+		return err
+	}
+	switch len(params) {
+	case 0:
+		return nil
+	case 1:
+		return json.Unmarshal(params[0], v)
+	default:
+		return fmt.Errorf("got %d positional params, want 1", len(params))
+	}
+}
+
+func acceptsJsonArray(t reflect.Type) bool {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Interface:
+		return true
+	default:
+		return false
+	}
+}
+
+func errorToJsonRpc(rpcErr *Error) *jsonRpcError {
+	code, ok := gJsonRpcCodes[rpcErr.Code]
+	if !ok {
+		code = jsonRpcServerError
+	}
+	data, _ := json.Marshal(rpcErr)
+	return &jsonRpcError{
+		Code:    code,
+		Message: rpcErr.Message,
+		Data:    data,
+	}
+}
+
+func errorFromJsonRpc(jErr *jsonRpcError) *Error {
+	rpcErr := new(Error)
+	if len(jErr.Data) != 0 && json.Unmarshal(jErr.Data, rpcErr) == nil && rpcErr.Code != 0 {
+		return rpcErr
+	}
+	rpcErr = NewError(CodeUnknown, jErr.Message)
+	for code, jCode := range gJsonRpcCodes {
+		if jCode == jErr.Code && code != CodeInParamNil {
+			rpcErr.Code = code
+			break
+		}
+	}
+	return rpcErr.WithDetail("jsonrpc.code", strconv.Itoa(jErr.Code))
+}
+
+// raw id of request is kept as msg id, so that ack echoes it as is.
+// ids issued by us are strings, unquote them to find promise,
+// response is dropped unless id issued by callable it arrived on
+func responseIdOf(id json.RawMessage) string {
+	var str string
+	if json.Unmarshal(id, &str) == nil {
+		return str
+	}
+	return string(id)
+}
+
+type jsonRpcBatchEntry struct {
+	id     json.RawMessage
+	item   int           // index of req in batch msg, -1 if invalid
+	notify bool          // notification never acked
+	err    *jsonRpcError // invalid request
+}
+
+// JSON-RPC 2.0 wire of one callable, RawMsg is translated from/to JSON-RPC messages
+type jsonRpcWire struct {
+	framing JsonRpcFraming
+	call    *BaseCallable
+	scanned int                             // newline framing: bytes scanned without newline, loop only
+	skip    int                             // content-length framing: bytes of oversize body to discard, loop only
+	queued  []*RawMsg                       // responses of array, loop only
+	batches map[string][]*jsonRpcBatchEntry // batch msg id -> entries
+	lock    *sync.Mutex
+}
+
+func newJsonRpcWire(call *BaseCallable, framing JsonRpcFraming) *jsonRpcWire {
+	std.Assert(framing == JsonRpcNewline || framing == JsonRpcContentLength, "unknown json-rpc framing")
+	return &jsonRpcWire{
+		framing: framing,
+		call:    call,
+		queued:  make([]*RawMsg, 0),
+		batches: make(map[string][]*jsonRpcBatchEntry),
+		lock:    &sync.Mutex{},
+	}
+}
+
+// speak JSON-RPC 2.0 instead of rpcx frames, must be invoked before Start.
+// handshake, heartbeat, streams and batch calls issued by this callable are not supported
+func (this *BaseCallable) SetJsonRpc(framing JsonRpcFraming) {
+	this.jsonRpc = newJsonRpcWire(this, framing)
+}
+
+// invoked in loop, invalid requests are answered directly and skipped
+func (this *jsonRpcWire) decode(buf std.ReadableBuffer, maxBodyLen int) (*RawMsg, error) {
+	for {
+		if len(this.queued) != 0 {
+			msg := this.queued[0]
+			this.queued = this.queued[1:]
+			return msg, nil
+		}
+		body, err := this.readBody(buf, maxBodyLen)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.TrimSpace(body)
+		if len(body) == 0 {
+			continue
+		}
+		msg, err := this.parse(body)
+		if err != nil {
+			return nil, err
+		}
+		if msg != nil {
+			return msg, nil
+		}
+	}
+}
+
+func (this *jsonRpcWire) readBody(buf std.ReadableBuffer, maxBodyLen int) ([]byte, error) {
+	if this.framing == JsonRpcNewline {
+		return this.readLine(buf, maxBodyLen)
+	}
+	return this.readContent(buf, maxBodyLen)
+}
+
+func (this *jsonRpcWire) readLine(buf std.ReadableBuffer, maxBodyLen int) ([]byte, error) {
+	readable := buf.ReadableLen()
+	if readable <= this.scanned {
+		return nil, ErrNeedMore
+	}
+	idx := bytes.IndexByte(buf.PeekN(this.scanned, readable-this.scanned), '\n')
+	if idx < 0 {
+		if readable > maxBodyLen {
+			buf.PopAll()
+			this.scanned = 0
+			return nil, newProtocolError(ProtoErrFrameTooLarge, "line len %d exceed %d", readable, maxBodyLen)
+		}
+		this.scanned = readable
+		return nil, ErrNeedMore
+	}
+	lineLen := this.scanned + idx
+	this.scanned = 0
+	line := buf.ReadN(lineLen)
+	buf.PopN(1)
+	return line, nil
+}
+
+func (this *jsonRpcWire) readContent(buf std.ReadableBuffer, maxBodyLen int) ([]byte, error) {
+	if this.skip != 0 {
+		n := this.skip
+		if n > buf.ReadableLen() {
+			n = buf.ReadableLen()
+		}
+		buf.PopN(n)
+		this.skip -= n
+		if this.skip != 0 {
+			return nil, ErrNeedMore
+		}
+	}
+	readable := buf.ReadableLen()
+	peekLen := readable
+	if peekLen > kJsonRpcMaxHeaderLen {
+		peekLen = kJsonRpcMaxHeaderLen
+	}
+	header := buf.PeekN(0, peekLen)
+	end := bytes.Index(header, kJsonRpcHeaderEnd)
+	if end < 0 {
+		if readable >= kJsonRpcMaxHeaderLen {
+			buf.PopN(peekLen)
+			return nil, newProtocolError(ProtoErrBadHeader, "%d bytes skipped", peekLen)
+		}
+		return nil, ErrNeedMore
+	}
+	headerLen := end + len(kJsonRpcHeaderEnd)
+	contentLen := -1
+	for _, line := range strings.Split(string(header[:end]), "\r\n") {
+		kv := strings.SplitN(line, ":", 2)
+		if len(kv) == 2 && strings.EqualFold(strings.TrimSpace(kv[0]), kJsonRpcContentLength) {
+			contentLen, _ = strconv.Atoi(strings.TrimSpace(kv[1]))
+		}
+	}
+	if contentLen < 0 {
+		buf.PopN(headerLen)
+		return nil, newProtocolError(ProtoErrBadHeader, "%s missing", kJsonRpcContentLength)
+	}
+	if contentLen > maxBodyLen {
+		buf.PopN(headerLen)
+		this.skip = contentLen
+		return nil, newProtocolError(ProtoErrFrameTooLarge, "content len %d exceed %d", contentLen, maxBodyLen)
+	}
+	if readable < headerLen+contentLen {
+		return nil, ErrNeedMore
+	}
+	buf.PopN(headerLen)
+	return buf.ReadN(contentLen), nil
+}
+
+// return nil msg if nothing to dispatch
+func (this *jsonRpcWire) parse(body []byte) (*RawMsg, error) {
+	if body[0] != '[' {
+		jMsg := new(jsonRpcMsg)
+		if err := json.Unmarshal(body, jMsg); err != nil {
+			this.reply(this.errorResponse(nil, jsonRpcParseError, err.Error()))
+			return nil, newProtocolError(ProtoErrUnmarshal, "%v", err)
+		}
+		msg, errRsp := this.toRawMsg(jMsg)
+		if errRsp != nil {
+			this.reply(errRsp)
+		}
+		return msg, nil
+	}
+	elements := make([]json.RawMessage, 0)
+	if err := json.Unmarshal(body, &elements); err != nil {
+		this.reply(this.errorResponse(nil, jsonRpcParseError, err.Error()))
+		return nil, newProtocolError(ProtoErrUnmarshal, "%v", err)
+	}
+	if len(elements) == 0 {
+		this.reply(this.errorResponse(nil, jsonRpcInvalidRequest, "empty batch"))
+		return nil, nil
+	}
+	return this.parseBatch(elements), nil
+}
+
+func (this *jsonRpcWire) parseBatch(elements []json.RawMessage) *RawMsg {
+	entries := make([]*jsonRpcBatchEntry, 0, len(elements))
+	items := make([]*RawMsg, 0, len(elements))
+	for _, element := range elements {
+		jMsg := new(jsonRpcMsg)
+		if err := json.Unmarshal(element, jMsg); err != nil {
+			entries = append(entries, &jsonRpcBatchEntry{
+				item: -1,
+				err:  &jsonRpcError{Code: jsonRpcInvalidRequest, Message: err.Error()},
+			})
+			continue
+		}
+		msg, errRsp := this.toRawMsg(jMsg)
+		if errRsp != nil {
+			entries = append(entries, &jsonRpcBatchEntry{id: jMsg.Id, item: -1, err: errRsp.Error})
+			continue
+		}
+		if msg.Type == AckMsg {
+			this.queued = append(this.queued, msg)
+			continue
+		}
+		entries = append(entries, &jsonRpcBatchEntry{
+			id:     jMsg.Id,
+			item:   len(items),
+			notify: msg.Type == NotifyMsg,
+		})
+		msg.Id = ""
+		msg.Type = ReqMsg
+		items = append(items, msg)
+	}
+	if len(items) == 0 {
+		this.replyBatch(entries, nil, nil)
+		return nil
+	}
+	data, err := gRpcSerialization.Marshal(items)
+	if err != nil {
+		this.replyBatch(entries, nil, AsError(err))
+		return nil
+	}
+	batchMsg := &RawMsg{
+		Id:       std.GenRandomUUID(),
+		Type:     BatchMsg,
+		Parallel: true,
+		Data:     data,
+	}
+	this.lock.Lock()
+	this.batches[batchMsg.Id] = entries
+	this.lock.Unlock()
+	return batchMsg
+}
+
+// error response returned if jMsg is invalid
+func (this *jsonRpcWire) toRawMsg(jMsg *jsonRpcMsg) (*RawMsg, *jsonRpcMsg) {
+	if jMsg.Version != kJsonRpcVersion {
+		return nil, this.errorResponse(jMsg.Id, jsonRpcInvalidRequest, "jsonrpc must be "+kJsonRpcVersion)
+	}
+	if jMsg.Method != nil {
+		msg := &RawMsg{
+			Id:         string(jMsg.Id),
+			MethodName: *jMsg.Method,
+			Type:       ReqMsg,
+			Codec:      CodecJsonRpc,
+			Data:       jMsg.Params,
+		}
+		if len(jMsg.Id) == 0 {
+			msg.Type = NotifyMsg
+		}
+		return msg, nil
+	}
+	if len(jMsg.Id) == 0 || (len(jMsg.Result) == 0 && jMsg.Error == nil) {
+		return nil, this.errorResponse(jMsg.Id, jsonRpcInvalidRequest, "neither request nor response")
+	}
+	msg := &RawMsg{
+		Id:    responseIdOf(jMsg.Id),
+		Type:  AckMsg,
+		Codec: CodecJsonRpc,
+		Data:  jMsg.Result,
+	}
+	if jMsg.Error != nil {
+		msg.Data = nil
+		msg.SetError(errorFromJsonRpc(jMsg.Error))
+	}
+	return msg, nil
+}
+
+func (this *jsonRpcWire) errorResponse(id json.RawMessage, code int, message string) *jsonRpcMsg {
+	if len(id) == 0 {
+		id = json.RawMessage("null")
+	}
+	return &jsonRpcMsg{
+		Version: kJsonRpcVersion,
+		Id:      id,
+		Error:   &jsonRpcError{Code: code, Message: message},
+	}
+}
+
+func (this *jsonRpcWire) reply(v interface{}) {
+	frame, err := this.marshalFrame(v)
+	if err != nil {
+		log.Println("json-rpc marshal response error -> ", err)
+		return
+	}
+	if writer := this.call.Writer(); writer != nil {
+		writer.Write(nil, frame, false)
+	}
+}
+
+// responses of invalid entries only, all of batch failed if batchErr not nil
+func (this *jsonRpcWire) replyBatch(entries []*jsonRpcBatchEntry, acks []*RawMsg, batchErr *Error) {
+	responses, err := this.batchResponses(entries, acks, batchErr)
+	if err != nil {
+		log.Println("json-rpc marshal batch response error -> ", err)
+		return
+	}
+	if len(responses) != 0 {
+		this.reply(responses)
+	}
+}
+
+func (this *jsonRpcWire) batchResponses(entries []*jsonRpcBatchEntry, acks []*RawMsg, batchErr *Error) ([]*jsonRpcMsg, error) {
+	responses := make([]*jsonRpcMsg, 0, len(entries))
+	for _, entry := range entries {
+		if entry.notify {
+			continue
+		}
+		if entry.err != nil {
+			responses = append(responses, this.errorResponse(entry.id, entry.err.Code, entry.err.Message))
+			continue
+		}
+		ack := &RawMsg{Type: AckMsg, Codec: CodecJsonRpc}
+		if batchErr != nil {
+			ack.SetError(batchErr)
+		} else if entry.item < len(acks) {
+			ack = acks[entry.item]
+		}
+		response, err := this.toResponse(entry.id, ack)
+		if err != nil {
+			return nil, err
+		}
+		responses = append(responses, response)
+	}
+	return responses, nil
+}
+
+func (this *jsonRpcWire) toResponse(id json.RawMessage, ack *RawMsg) (*jsonRpcMsg, error) {
+	if len(id) == 0 {
+		id = json.RawMessage("null")
+	}
+	response := &jsonRpcMsg{
+		Version: kJsonRpcVersion,
+		Id:      id,
+	}
+	if err := ack.GetError(); err != nil {
+		response.Error = errorToJsonRpc(AsError(err))
+		return response, nil
+	}
+	if !isJsonCodec(ack.Codec) {
+		return nil, fmt.Errorf("%w `%s`", ErrUnsupportedCodec, ack.Codec)
+	}
+	response.Result = ack.Data
+	if len(response.Result) == 0 {
+		response.Result = json.RawMessage("null")
+	}
+	return response, nil
+}
+
+func isJsonCodec(name string) bool {
+	return name == CodecJsonRpc || name == CodecJson
+}
+
+// params must be structured, Args sent as positional params,
+// others wrapped as single positional param, e.g. []int{1,2} sent as [[1,2]]
+func toJsonRpcParams(data []byte, args bool) json.RawMessage {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || (args && data[0] == '[') {
+		return data
+	}
+	params := make([]byte, 0, len(data)+2)
+	params = append(params, '[')
+	params = append(params, data...)
+	return append(params, ']')
+}
+
+func (this *jsonRpcWire) encode(msg *RawMsg) ([]byte, error) {
+	switch msg.Type {
+	case ReqMsg, NotifyMsg:
+		if len(msg.Data) != 0 && !isJsonCodec(msg.Codec) {
+			return nil, fmt.Errorf("%w `%s`", ErrUnsupportedCodec, msg.Codec)
+		}
+		method := msg.MethodName
+		request := &jsonRpcMsg{
+			Version: kJsonRpcVersion,
+			Method:  &method,
+			Params:  toJsonRpcParams(msg.Data, msg.args),
+		}
+		if msg.Type == ReqMsg {
+			request.Id, _ = json.Marshal(msg.Id)
+		}
+		return this.marshalFrame(request)
+	case AckMsg:
+		this.lock.Lock()
+		entries, isBatch := this.batches[msg.Id]
+		delete(this.batches, msg.Id)
+		this.lock.Unlock()
+		if isBatch {
+			return this.encodeBatchAck(entries, msg)
+		}
+		response, err := this.toResponse(json.RawMessage(msg.Id), msg)
+		if err != nil {
+			return nil, err
+		}
+		return this.marshalFrame(response)
+	default:
+		return nil, ErrJsonRpcUnsupported
+	}
+}
+
+func (this *jsonRpcWire) encodeBatchAck(entries []*jsonRpcBatchEntry, ackMsg *RawMsg) ([]byte, error) {
+	acks := make([]*RawMsg, 0, len(entries))
+	batchErr := AsError(ackMsg.GetError())
+	if batchErr == nil {
+		if err := gRpcSerialization.UnMarshal(ackMsg.Data, &acks); err != nil {
+			return nil, err
+		}
+	}
+	responses, err := this.batchResponses(entries, acks, batchErr)
+	if err != nil {
+		return nil, err
+	}
+	if len(responses) == 0 {
+		return nil, nil // all of batch are notifications
+	}
+	return this.marshalFrame(responses)
+}
+
+func (this *jsonRpcWire) marshalFrame(v interface{}) ([]byte, error) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if this.framing == JsonRpcNewline {
+		return append(body, '\n'), nil
+	}
+	header := fmt.Sprintf("%s: %d\r\n\r\n", kJsonRpcContentLength, len(body))
+	return append([]byte(header), body...), nil
+}
@@ -2,11 +2,14 @@ package rpcx
 
 import (
 	"errors"
+	"fmt"
 	"github.com/gen-iot/std"
-	"log"
+	"hash/crc32"
+	"time"
 )
 
-// HEADER(FE FE) 2 |DATA_LEN 4| DATA N|
+// v2: HEADER(FE FE) 2 |DATA_LEN 4| DATA N|
+// v3: HEADER(FE FD) 2 |VERSION 1|FLAGS 1|KIND 1|DATA_LEN 4| DATA N|
 
 const kHeaderLen = 2
 const kDataLen = 4
@@ -17,25 +20,95 @@ const kDataOffset = kDataLenOffset + kDataLen
 
 const kMinMsgLen = kDataOffset
 
+const kHeaderV2 = 0xFEFE
+const kHeaderV3 = 0xFEFD
+
+const kVersionOffsetV3 = kHeaderOffset + kHeaderLen
+const kFlagsOffsetV3 = kVersionOffsetV3 + 1
+const kKindOffsetV3 = kFlagsOffsetV3 + 1
+const kDataLenOffsetV3 = kKindOffsetV3 + 1
+const kDataOffsetV3 = kDataLenOffsetV3 + kDataLen
+
+const kMinMsgLenV3 = kDataOffsetV3
+
+// wire framing, peers talk in v2 until both of them agree on v3
+const (
+	FramingV2 = 2
+	FramingV3 = 3
+)
+
+// bits of v3 frame flags, frame with unknown flags will be dropped
+type FrameFlags uint8
+
+const (
+	FrameFlagCompressed FrameFlags = 1 << iota // body compressed, see compressBody
+	FrameFlagChecksum                          // crc32 of body appended, |BODY N|CRC32 4|
+)
+
+const kKnownFrameFlags = FrameFlagCompressed | FrameFlagChecksum
+
+const kChecksumLen = 4
+
 var ErrNeedMore = errors.New("codec want read more bytes")
+var ErrMsgTooLarge = errors.New("rpc msg too large")
+
+// msg encoded larger than kFragmentSize will be sent as fragments if peer supports it,
+// keep frames small so that each of them could be written by socket at once
+const kFragmentSize = 1024 * 32
+
+// bytes of partial msgs held by one callable, at least max msg size of core
+const kMaxFragmentInflight = 1024 * 1024 * 64
+
+// partial msg dropped if no more fragment of it arrived in time
+const kFragmentExpire = time.Second * 30
+
+const DefaultMaxMsgSize = 1024 * 1024 * 256
 
 type MsgType int
 
 const (
 	ReqMsg MsgType = iota
 	AckMsg
+	CancelMsg       // caller gave up, callee should stop handling req with same Id
+	NotifyMsg       // one-way req, callee never ack
+	StreamOpenMsg   // open stream, callee finish stream with ack
+	StreamDataMsg   // stream payload
+	StreamEndMsg    // caller half close
+	StreamCreditMsg // grant peer more credits to send
+	FragmentMsg     // part of large msg
+	PingMsg         // heartbeat probe
+	PongMsg         // heartbeat reply, echo stamp of ping
+	HelloMsg        // handshake, carries PeerInfo of sender
+	HelloAckMsg     // handshake verdict of peer, error set if rejected
+	BatchMsg        // many reqs in one msg, callee acks all results in one msg
 )
 
 type RawMsg struct {
-	Id         string            `json:"msgId"`
+	Id         string            `json:"msgId,omitempty"` // uuid, omitted if Seq is used
 	MethodName string            `json:"methodName"`
 	Headers    map[string]string `json:"headers"`
-	Type       MsgType           `json:"type"` // req or ack
-	Err        *string           `json:"err"`  // fast path for ack error
-	Data       []byte            `json:"data"` // req = param
+	Type       MsgType           `json:"type"`                 // req or ack
+	Timeout    int64             `json:"timeout,omitempty"`    // req remaining deadline in milliseconds, 0 means no deadline
+	FromCallee bool              `json:"fromCallee,omitempty"` // stream frame or fragment direction
+	Credit     uint32            `json:"credit,omitempty"`     // stream credit grant
+	Codec      string            `json:"codec,omitempty"`      // payload codec, empty means msgpack
+	Err        *string           `json:"err"`                  // fast path for ack error
+	Error      *Error            `json:"error,omitempty"`      // structured ack error
+	Origin     MsgType           `json:"origin,omitempty"`     // fragment: type of large msg
+	Total      int               `json:"total,omitempty"`      // fragment: encoded len of large msg
+	Stamp      int64             `json:"stamp,omitempty"`      // ping/pong: send time of ping in nanoseconds
+	Seq        uint64            `json:"seq,omitempty"`        // compact id scoped per callable
+	Parallel   bool              `json:"parallel,omitempty"`   // batch: handle reqs concurrently
+	Data       []byte            `json:"data"`                 // req = param
+
+	framing int  // framing of frame which carries this msg, set by decoder
+	args    bool // data set from Args, JSON-RPC sends it as positional params
 }
 
 func (this *RawMsg) GetError() error {
+	if this.Error != nil {
+		return this.Error
+	}
 	if this.Err == nil {
 		return nil
 	}
@@ -46,24 +119,43 @@ func (this *RawMsg) SetErrorString(es string) {
 	this.Err = &es
 }
 
+// Err keeps plain message for peers don't know structured error
 func (this *RawMsg) SetError(err error) {
 	if err == nil {
 		return
 	}
 	es := err.Error()
 	this.Err = &es
+	this.Error = AsError(err)
+}
+
+func (this *RawMsg) codec() (Codec, error) {
+	codec := GetCodec(this.Codec)
+	if codec == nil {
+		return nil, fmt.Errorf("%w `%s`", ErrUnsupportedCodec, this.Codec)
+	}
+	return codec, nil
 }
 
 func (this *RawMsg) BindData(v interface{}) error {
-	return gRpcSerialization.UnMarshal(this.Data, v)
+	codec, err := this.codec()
+	if err != nil {
+		return err
+	}
+	return codec.UnMarshal(this.Data, v)
 }
 
 func (this *RawMsg) SetData(v interface{}) error {
+	_, this.args = v.(Args)
 	if v == nil {
 		this.Data = nil
 		return nil
 	}
-	bytes, err := gRpcSerialization.Marshal(v)
+	codec, err := this.codec()
+	if err != nil {
+		return err
+	}
+	bytes, err := codec.Marshal(v)
 	if err != nil {
 		return err
 	}
@@ -71,50 +163,335 @@ func (this *RawMsg) SetData(v interface{}) error {
 	return nil
 }
 
+// decode both v2 and v3 frames,
+// *ProtocolError returned after bad frame consumed, caller could keep decoding
 func decodeRpcMsg(buf std.ReadableBuffer, maxBodyLen int) (*RawMsg, error) {
+	return new(frameDecoder).decode(buf, maxBodyLen)
+}
+
+// decode frames of one callable, only accessed in loop
+type frameDecoder struct {
+	skip int // body bytes of oversized frame not received yet
+}
+
+func newFrameDecoder() *frameDecoder {
+	return &frameDecoder{}
+}
+
+// discard body of oversized frame as it arrives
+func (this *frameDecoder) discard(buf std.ReadableBuffer) bool {
+	n := this.skip
+	if n > buf.ReadableLen() {
+		n = buf.ReadableLen()
+	}
+	buf.PopN(n)
+	this.skip -= n
+	return this.skip == 0
+}
+
+func (this *frameDecoder) decode(buf std.ReadableBuffer, maxBodyLen int) (*RawMsg, error) {
 	std.Assert(maxBodyLen > 0, "maxBodyLen must > 0")
+	if this.skip != 0 && !this.discard(buf) {
+		return nil, ErrNeedMore
+	}
+	skipped := 0
 	for {
 		if buf.ReadableLen() < kMinMsgLen {
+			if skipped != 0 {
+				return nil, newProtocolError(ProtoErrBadHeader, "%d bytes skipped", skipped)
+			}
 			return nil, ErrNeedMore
 		}
 		header := buf.PeekUInt16(kHeaderOffset)
-		if header != 0xFEFE {
+		framing := FramingV2
+		minMsgLen := kMinMsgLen
+		dataLenOffset := kDataLenOffset
+		switch header {
+		case kHeaderV2:
+		case kHeaderV3:
+			framing = FramingV3
+			minMsgLen = kMinMsgLenV3
+			dataLenOffset = kDataLenOffsetV3
+		default:
 			buf.PopN(1)
+			skipped++
 			continue
 		}
-		dataLen := buf.PeekInt32(kDataLenOffset)
+		if skipped != 0 {
+			// report garbage first, frame will be decoded next time
+			return nil, newProtocolError(ProtoErrBadHeader, "%d bytes skipped", skipped)
+		}
+		if buf.ReadableLen() < minMsgLen {
+			return nil, ErrNeedMore
+		}
+		dataLen := buf.PeekInt32(dataLenOffset)
 		if dataLen < 0 {
 			buf.PopN(1)
+			skipped++
 			continue
 		}
-		if dataLen > int32(buf.ReadableLen()-kMinMsgLen) {
+		if int(dataLen) > maxBodyLen {
+			// reject before body received, skip body without buffering it
+			buf.PopN(minMsgLen)
+			this.skip = int(dataLen)
+			this.discard(buf)
+			return nil, newProtocolError(ProtoErrFrameTooLarge, "frame len %d exceed %d", dataLen, maxBodyLen)
+		}
+		if dataLen > int32(buf.ReadableLen()-minMsgLen) {
 			return nil, ErrNeedMore
 		}
-		if int(dataLen) > maxBodyLen {
-			buf.PopN(kMinMsgLen + int(dataLen))
-			continue
+		var version uint8 = FramingV2
+		var flags FrameFlags = 0
+		var kind MsgType = 0
+		if framing == FramingV3 {
+			version = buf.PeekUInt8(kVersionOffsetV3)
+			flags = FrameFlags(buf.PeekUInt8(kFlagsOffsetV3))
+			kind = MsgType(buf.PeekUInt8(kKindOffsetV3))
 		}
-		buf.PopN(kDataOffset)
+		buf.PopN(minMsgLen)
 		data := buf.ReadN(int(dataLen))
-		outMsg := new(RawMsg)
-		err := gRpcSerialization.UnMarshal(data, outMsg)
+		if framing == FramingV3 && (version != FramingV3 || flags&^kKnownFrameFlags != 0) {
+			// sent by newer peer, skip it as a whole
+			return nil, newProtocolError(ProtoErrUnsupported, "frame version %d flags %#x", version, flags)
+		}
+		if flags&FrameFlagChecksum != 0 {
+			if len(data) < kChecksumLen {
+				return nil, newProtocolError(ProtoErrChecksum, "frame len %d too short", len(data))
+			}
+			body := data[:len(data)-kChecksumLen]
+			sum := std.ArrToUint32BE(data[len(data)-kChecksumLen:])
+			if crc32.ChecksumIEEE(body) != sum {
+				return nil, newProtocolError(ProtoErrChecksum, "kind %d len %d", kind, len(body))
+			}
+			data = body
+		}
+		if flags&FrameFlagCompressed != 0 {
+			decompressed, err := decompressBody(data, maxBodyLen)
+			if err != nil {
+				return nil, newProtocolError(ProtoErrDecompress, "%v", err)
+			}
+			data = decompressed
+		}
+		outMsg, err := unmarshalRpcMsg(data)
 		if err != nil {
-			log.Println("unmarshal rpcx msg failed -> ", err)
-			continue
+			return nil, newProtocolError(ProtoErrUnmarshal, "%v", err)
 		}
+		if framing == FramingV3 && outMsg.Type != kind {
+			return nil, newProtocolError(ProtoErrKindMismatch, "frame kind %d,msg type %d", kind, outMsg.Type)
+		}
+		outMsg.framing = framing
 		return outMsg, nil
 	}
 }
 
+func unmarshalRpcMsg(data []byte) (*RawMsg, error) {
+	outMsg := new(RawMsg)
+	err := gRpcSerialization.UnMarshal(data, outMsg)
+	if err != nil {
+		return nil, err
+	}
+	return outMsg, nil
+}
+
+// local id of compact msg never sent
+func marshalRpcMsg(msg *RawMsg) ([]byte, error) {
+	std.Assert(len(msg.Id) == 32 || msg.Seq != 0, "msgId.Len != 32")
+	if msg.Seq != 0 && len(msg.Id) != 0 {
+		wire := *msg
+		wire.Id = ""
+		return gRpcSerialization.Marshal(&wire)
+	}
+	return gRpcSerialization.Marshal(msg)
+}
+
 func encodeRpcMsg(msg *RawMsg) ([]byte, error) {
-	std.Assert(len(msg.Id) == 32, "msgId.Len != 32")
-	buffer := std.NewByteBuffer()
-	datas, err := gRpcSerialization.Marshal(msg)
+	return encodeRpcMsgWith(msg, frameEncoder{framing: FramingV2})
+}
+
+func encodeRpcMsgWith(msg *RawMsg, enc frameEncoder) ([]byte, error) {
+	if enc.jsonRpc != nil {
+		return enc.jsonRpc.encode(msg)
+	}
+	datas, err := marshalRpcMsg(msg)
 	if err != nil {
 		return nil, err
 	}
-	buffer.WriteUInt16(0xFEFE)
-	buffer.WriteInt32(int32(len(datas)))
-	buffer.Write(datas)
-	return buffer.ToArray(), nil
+	return enc.encodeFrame(datas, msg.Type)
+}
+
+func encodeFrame(datas []byte, framing int, kind MsgType, flags FrameFlags) []byte {
+	if framing != FramingV3 {
+		out := make([]byte, 0, kMinMsgLen+len(datas))
+		out = append(out, std.Uint16ToArrBE(kHeaderV2)...)
+		out = append(out, std.Int32ToArrBE(int32(len(datas)))...)
+		return append(out, datas...)
+	}
+	out := make([]byte, 0, kMinMsgLenV3+len(datas))
+	out = append(out, std.Uint16ToArrBE(kHeaderV3)...)
+	out = append(out, FramingV3, uint8(flags), uint8(kind))
+	out = append(out, std.Int32ToArrBE(int32(len(datas)))...)
+	return append(out, datas...)
+}
+
+// msg sent by callee side of call: acks, pongs and callee stream frames
+func isReply(msgType MsgType, fromCallee bool) bool {
+	switch msgType {
+	case AckMsg, PongMsg:
+		return true
+	case StreamDataMsg, StreamEndMsg, StreamCreditMsg, FragmentMsg:
+		return fromCallee
+	default:
+		return false
+	}
+}
+
+// large msg will be split into fragments if peer supports it, so that they could be interleaved with other frames,
+// otherwise sent as single frame limited by max msg size of peer
+func encodeRpcFrames(msg *RawMsg, maxMsgSize int, enc frameEncoder) ([][]byte, error) {
+	if enc.jsonRpc != nil {
+		// JSON-RPC has no fragment
+		frame, err := enc.jsonRpc.encode(msg)
+		if err != nil {
+			return nil, err
+		}
+		if len(frame) > maxMsgSize {
+			return nil, ErrMsgTooLarge
+		}
+		if len(frame) == 0 {
+			return nil, nil
+		}
+		return [][]byte{frame}, nil
+	}
+	datas, err := marshalRpcMsg(msg)
+	if err != nil {
+		return nil, err
+	}
+	if len(datas) > maxMsgSize {
+		return nil, ErrMsgTooLarge
+	}
+	if !enc.fragment && len(datas) > enc.peerMaxFrameLen() {
+		return nil, ErrMsgTooLarge
+	}
+	if !enc.fragment || len(datas) <= kFragmentSize {
+		frame, err := enc.encodeFrame(datas, msg.Type)
+		if err != nil {
+			return nil, err
+		}
+		return [][]byte{frame}, nil
+	}
+	frames := make([][]byte, 0, len(datas)/kFragmentSize+1)
+	for offset := 0; offset < len(datas); offset += kFragmentSize {
+		end := offset + kFragmentSize
+		if end > len(datas) {
+			end = len(datas)
+		}
+		fragment, err := encodeRpcMsgWith(&RawMsg{
+			Id:         msg.Id,
+			Seq:        msg.Seq,
+			MethodName: msg.MethodName,
+			Type:       FragmentMsg,
+			FromCallee: isReply(msg.Type, msg.FromCallee),
+			Origin:     msg.Type,
+			Total:      len(datas),
+			Data:       datas[offset:end],
+		}, enc)
+		if err != nil {
+			return nil, err
+		}
+		frames = append(frames, fragment)
+	}
+	return frames, nil
+}
+
+func writeFrames(writer Writer, ctx Context, frames [][]byte) {
+	if writer == nil {
+		return
+	}
+	for _, frame := range frames {
+		writer.Write(ctx, frame, false)
+	}
+}
+
+type fragmentBuffer struct {
+	data     []byte
+	total    int
+	received int
+	discard  bool
+	expireAt time.Time
+}
+
+// same id may be used by both sides, e.g. ack of peer and req of local
+type fragmentKey struct {
+	fromCallee bool
+	key        msgKey
+}
+
+// reassemble fragments of one callable, only accessed in loop
+type fragmentAssembler struct {
+	buffers  map[fragmentKey]*fragmentBuffer
+	inflight int // bytes held by partial msgs
+}
+
+func newFragmentAssembler() *fragmentAssembler {
+	return &fragmentAssembler{
+		buffers: make(map[fragmentKey]*fragmentBuffer),
+	}
+}
+
+// drop partial msgs whose fragments stopped arriving
+func (this *fragmentAssembler) expire(now time.Time) {
+	for key, buf := range this.buffers {
+		if now.After(buf.expireAt) {
+			this.inflight -= len(buf.data)
+			delete(this.buffers, key)
+		}
+	}
+}
+
+// return whole msg after all fragments received,
+// ErrMsgTooLarge returned once if msg exceed maxMsgSize or partial msgs of callable exceed kMaxFragmentInflight,
+// rest fragments of it will be discarded
+func (this *fragmentAssembler) append(fragment *RawMsg, maxMsgSize int) (*RawMsg, error) {
+	now := time.Now()
+	this.expire(now)
+	maxInflight := kMaxFragmentInflight
+	if maxInflight < maxMsgSize {
+		maxInflight = maxMsgSize
+	}
+	var err error = nil
+	key := fragmentKey{fromCallee: fragment.FromCallee, key: keyOf(fragment)}
+	buf, ok := this.buffers[key]
+	if !ok {
+		buf = &fragmentBuffer{
+			total:   fragment.Total,
+			discard: fragment.Total > maxMsgSize,
+		}
+		if buf.discard {
+			err = ErrMsgTooLarge
+		}
+		this.buffers[key] = buf
+	}
+	buf.expireAt = now.Add(kFragmentExpire)
+	buf.received += len(fragment.Data)
+	if !buf.discard && (buf.received > buf.total || this.inflight+len(fragment.Data) > maxInflight) {
+		// peer lied about total, or too many partial msgs
+		buf.discard = true
+		this.inflight -= len(buf.data)
+		buf.data = nil
+		err = ErrMsgTooLarge
+	}
+	if !buf.discard {
+		// grows as fragments arrive, total announced by peer is not trusted
+		buf.data = append(buf.data, fragment.Data...)
+		this.inflight += len(fragment.Data)
+	}
+	if buf.received < buf.total {
+		return nil, err
+	}
+	delete(this.buffers, key)
+	this.inflight -= len(buf.data)
+	if buf.discard {
+		return nil, err
+	}
+	return unmarshalRpcMsg(buf.data)
 }
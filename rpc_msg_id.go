@@ -0,0 +1,76 @@
+package rpcx
+
+import (
+	"github.com/gen-iot/std"
+	"strconv"
+	"sync/atomic"
+)
+
+// callables of one process get different id prefix, so that ids of compact msgs never collide
+var gCallableIdSeq uint64 = 0
+
+// compact msg ids are sequences scoped per callable, only the sequence is sent.
+// string id is built on demand, with callable prefix.
+// seqs issued by peer get another prefix, so that they never collide with seqs issued by local
+type msgIdGenerator struct {
+	prefix     string
+	peerPrefix string
+	seq        uint64
+}
+
+func newMsgIdGenerator() *msgIdGenerator {
+	callableId := strconv.FormatUint(atomic.AddUint64(&gCallableIdSeq, 1), 36)
+	return &msgIdGenerator{
+		prefix:     callableId + "#",
+		peerPrefix: callableId + "@",
+	}
+}
+
+func (this *msgIdGenerator) next() uint64 {
+	return atomic.AddUint64(&this.seq, 1)
+}
+
+func (this *msgIdGenerator) localId(seq uint64) string {
+	return this.prefix + strconv.FormatUint(seq, 36)
+}
+
+func (this *msgIdGenerator) peerId(seq uint64) string {
+	return this.peerPrefix + strconv.FormatUint(seq, 36)
+}
+
+// key of msg in tables of callable, id of legacy msg or seq of compact msg.
+// tables are split by issuer already, so seq alone is enough
+type msgKey struct {
+	id  string
+	seq uint64
+}
+
+func keyOf(msg *RawMsg) msgKey {
+	return msgKey{id: msg.Id, seq: msg.Seq}
+}
+
+func (this msgKey) String() string {
+	if len(this.id) != 0 {
+		return this.id
+	}
+	return "#" + strconv.FormatUint(this.seq, 36)
+}
+
+// compact id used after peer announced it, id is empty then
+func (this *BaseCallable) nextMsgId() (string, uint64) {
+	if peer := this.Peer(); peer != nil && peer.Supports(FeatureCompactId) {
+		return "", this.msgIds.next()
+	}
+	return std.GenRandomUUID(), 0
+}
+
+// string id of msg, built from seq for compact msg
+func (this *BaseCallable) msgIdOf(msg *RawMsg, issued bool) string {
+	if len(msg.Id) != 0 || msg.Seq == 0 {
+		return msg.Id
+	}
+	if issued {
+		return this.msgIds.localId(msg.Seq)
+	}
+	return this.msgIds.peerId(msg.Seq)
+}
@@ -1,9 +1,13 @@
 package rpcx
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"github.com/gen-iot/std"
+	"strings"
 	"testing"
+	"time"
 )
 
 type exampleStruct struct {
@@ -49,3 +53,260 @@ func TestUUID(t *testing.T) {
 	uuid := std.GenRandomUUID()
 	fmt.Println("uuid -> ", uuid, " len -> ", len(uuid))
 }
+
+func TestDecodeMixedFraming(t *testing.T) {
+	buffer := std.NewByteBuffer()
+	for _, framing := range []int{FramingV2, FramingV3, FramingV2} {
+		msg := &RawMsg{
+			Id:         std.GenRandomUUID(),
+			MethodName: "sum",
+			Type:       AckMsg,
+		}
+		bytes, err := encodeRpcMsgWith(msg, frameEncoder{framing: framing})
+		std.AssertError(err, "encodeRpcMsgWith")
+		buffer.Write(bytes)
+	}
+	// frame of future version will be skipped
+	future := encodeFrame([]byte{0x01, 0x02}, FramingV3, ReqMsg, 0)
+	future[kVersionOffsetV3] = FramingV3 + 1
+	buffer.Write(future)
+	for _, framing := range []int{FramingV2, FramingV3, FramingV2} {
+		outMsg, err := decodeRpcMsg(buffer, 1024*1024*4)
+		std.AssertError(err, "decodeRpcMsg")
+		std.Assert(outMsg.framing == framing, "framing mismatched")
+		std.Assert(outMsg.Type == AckMsg && outMsg.MethodName == "sum", "msg mismatched")
+	}
+	_, err := decodeRpcMsg(buffer, 1024*1024*4)
+	protoErr, ok := err.(*ProtocolError)
+	std.Assert(ok && protoErr.Kind == ProtoErrUnsupported, "future frame should be reported")
+	std.Assert(buffer.ReadableLen() == 0, "buffer should be drained")
+}
+
+func TestDecodeCompressedFrame(t *testing.T) {
+	for _, compressor := range []Compressor{DeflateCompressor, GzipCompressor} {
+		msg := &RawMsg{
+			Id:         std.GenRandomUUID(),
+			MethodName: "report",
+			Type:       ReqMsg,
+			Data:       []byte(strings.Repeat("temperature=26;", 1024)),
+		}
+		plain, err := encodeRpcMsgWith(msg, frameEncoder{framing: FramingV3})
+		std.AssertError(err, "encode plain")
+		compressed, err := encodeRpcMsgWith(msg, frameEncoder{
+			framing:    FramingV3,
+			compressor: compressor,
+			threshold:  DefaultCompressThreshold,
+		})
+		std.AssertError(err, "encode compressed")
+		fmt.Println(compressor.Name(), "plain -> ", len(plain), " compressed -> ", len(compressed))
+		std.Assert(len(compressed) < len(plain), "frame should be compressed")
+		std.Assert(FrameFlags(compressed[kFlagsOffsetV3])&FrameFlagCompressed != 0, "compressed flag not set")
+		buffer := std.NewByteBuffer()
+		buffer.Write(compressed)
+		outMsg, err := decodeRpcMsg(buffer, 1024*1024*4)
+		std.AssertError(err, "decodeRpcMsg")
+		std.Assert(string(outMsg.Data) == string(msg.Data), "data mismatched")
+	}
+}
+
+func TestDecodeBadFrames(t *testing.T) {
+	msg := &RawMsg{
+		Id:         std.GenRandomUUID(),
+		MethodName: "sum",
+		Type:       ReqMsg,
+		Data:       []byte("payload"),
+	}
+	enc := frameEncoder{framing: FramingV3, checksum: true}
+	good, err := encodeRpcMsgWith(msg, enc)
+	std.AssertError(err, "encode")
+	std.Assert(FrameFlags(good[kFlagsOffsetV3])&FrameFlagChecksum != 0, "checksum flag not set")
+	corrupted, err := encodeRpcMsgWith(msg, enc)
+	std.AssertError(err, "encode")
+	corrupted[len(corrupted)-kChecksumLen-1] ^= 0xFF
+
+	buffer := std.NewByteBuffer()
+	buffer.Write([]byte{0x01, 0x02, 0x03})
+	buffer.Write(corrupted)
+	buffer.Write(encodeFrame([]byte{0xC1}, FramingV2, ReqMsg, 0))
+	buffer.Write(good)
+
+	expects := []ProtocolErrorKind{ProtoErrBadHeader, ProtoErrChecksum, ProtoErrUnmarshal}
+	for _, kind := range expects {
+		_, err := decodeRpcMsg(buffer, 1024*1024*4)
+		fmt.Println("decode err -> ", err)
+		std.Assert(errors.Is(err, ErrProtocol), "should be protocol error")
+		std.Assert(err.(*ProtocolError).Kind == kind, "protocol error kind mismatched")
+	}
+	outMsg, err := decodeRpcMsg(buffer, 1024*1024*4)
+	std.AssertError(err, "decode good frame")
+	std.Assert(string(outMsg.Data) == "payload", "data mismatched")
+}
+
+func TestDecodeOversizedFrame(t *testing.T) {
+	msg := &RawMsg{
+		Id:         std.GenRandomUUID(),
+		MethodName: "sum",
+		Type:       ReqMsg,
+		Data:       []byte("payload"),
+	}
+	good, err := encodeRpcMsg(msg)
+	std.AssertError(err, "encode")
+	large := encodeFrame(make([]byte, 1024), FramingV2, ReqMsg, 0)
+
+	decoder := newFrameDecoder()
+	buffer := std.NewByteBuffer()
+	// only header of large frame arrived
+	buffer.Write(large[:kMinMsgLen+16])
+	_, err = decoder.decode(buffer, 512)
+	std.Assert(errors.Is(err, ErrProtocol), "should be protocol error")
+	std.Assert(err.(*ProtocolError).Kind == ProtoErrFrameTooLarge, "should reject before body received")
+	std.Assert(buffer.ReadableLen() == 0, "received body should be discarded")
+	// rest of body discarded as it arrives
+	buffer.Write(large[kMinMsgLen+16:])
+	buffer.Write(good)
+	outMsg, err := decoder.decode(buffer, 512)
+	std.AssertError(err, "decode good frame")
+	std.Assert(string(outMsg.Data) == "payload", "data mismatched")
+}
+
+func TestCompactMsgId(t *testing.T) {
+	uuidMsg := &RawMsg{
+		Id:         std.GenRandomUUID(),
+		MethodName: "report",
+		Type:       NotifyMsg,
+		Data:       []byte{0x01},
+	}
+	ids := newMsgIdGenerator()
+	seq := ids.next()
+	compactMsg := &RawMsg{
+		Seq:        seq,
+		MethodName: "report",
+		Type:       NotifyMsg,
+		Data:       []byte{0x01},
+	}
+	uuidBytes, err := encodeRpcMsg(uuidMsg)
+	std.AssertError(err, "encode uuid msg")
+	compactBytes, err := encodeRpcMsg(compactMsg)
+	std.AssertError(err, "encode compact msg")
+	fmt.Println("uuid -> ", len(uuidBytes), " compact -> ", len(compactBytes))
+	std.Assert(len(uuidBytes)-len(compactBytes) >= 24, "compact msg should be smaller")
+
+	buffer := std.NewByteBuffer()
+	buffer.Write(compactBytes)
+	outMsg, err := decodeRpcMsg(buffer, 1024*1024*4)
+	std.AssertError(err, "decodeRpcMsg")
+	std.Assert(len(outMsg.Id) == 0 && outMsg.Seq == seq, "only seq should be sent")
+	std.Assert(keyOf(outMsg) == keyOf(compactMsg), "compact msg should be keyed by seq")
+	peerIds := newMsgIdGenerator()
+	std.Assert(peerIds.localId(seq) != ids.localId(seq), "local ids of different callables should not collide")
+
+	// seqs issued by peer never collide with local ones
+	call := &BaseCallable{msgIds: ids}
+	std.Assert(call.msgIdOf(outMsg, true) == ids.localId(seq), "issued seq should be built as local id")
+	std.Assert(call.msgIdOf(outMsg, false) != ids.localId(seq), "peer seq should not be built as local id")
+	std.Assert(call.msgIdOf(uuidMsg, false) == uuidMsg.Id, "legacy id should be kept")
+}
+
+// not a BaseCallable, calls kept in promise group of core
+type customCallable struct {
+	Callable
+}
+
+func TestAckOfOtherCallable(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	core, err := New()
+	std.AssertError(err, "new rpc")
+	defer std.CloseIgnoreErr(core)
+	core.Start(ctx)
+	impl := core.(*coreImpl)
+	owner := NewBaseCallable(core, nil, nil)
+	other := NewBaseCallable(core, nil, nil)
+	seq := owner.msgIds.next()
+	promise := std.NewPromise()
+	std.Assert(owner.pending.add(msgKey{seq: seq}, pendingCall{promise: promise}), "add pending")
+
+	// guessed seq sent through another connection
+	impl.handleAck(other, &RawMsg{Seq: seq, Type: AckMsg})
+	std.Assert(promise.Wait(time.Millisecond*100) == std.ErrFutureTimeout, "spoofed ack should be dropped")
+	impl.handleAck(owner, &RawMsg{Seq: seq, Type: AckMsg})
+	std.AssertError(promise.Wait(time.Second), "ack of owner should done call")
+
+	msgId := std.GenRandomUUID()
+	promise = std.NewPromise()
+	impl.promiseGroup.AddPromise(std.PromiseId(msgId), promise)
+	impl.handleAck(customCallable{}, &RawMsg{Id: msgId, Type: AckMsg})
+	std.AssertError(promise.Wait(time.Second), "ack of custom callable should done call through promise group")
+}
+
+func TestFragmentAssembler(t *testing.T) {
+	msg := &RawMsg{Id: std.GenRandomUUID(), MethodName: "echo", Type: ReqMsg}
+	std.AssertError(msg.SetData(strings.Repeat("rpcx", 1024*16)), "set data")
+	frames, err := encodeRpcFrames(msg, DefaultMaxMsgSize, frameEncoder{framing: FramingV2})
+	std.AssertError(err, "encode without fragment")
+	std.Assert(len(frames) == 1, "peer without fragment should get single frame")
+	frames, err = encodeRpcFrames(msg, DefaultMaxMsgSize, frameEncoder{framing: FramingV2, fragment: true})
+	std.AssertError(err, "encode fragments")
+	std.Assert(len(frames) > 1, "large msg should be fragmented")
+
+	decodeAll := func(frames [][]byte) []*RawMsg {
+		buffer := std.NewByteBuffer()
+		for _, frame := range frames {
+			buffer.Write(frame)
+		}
+		out := make([]*RawMsg, 0, len(frames))
+		for {
+			fragment, err := decodeRpcMsg(buffer, DefaultMaxMsgSize)
+			if err != nil {
+				return out
+			}
+			out = append(out, fragment)
+		}
+	}
+	req := decodeAll(frames)
+	ack := decodeAll(frames)
+	for _, it := range ack {
+		it.FromCallee = true // same id sent by peer as ack
+	}
+	assembler := newFragmentAssembler()
+	var whole *RawMsg = nil
+	for i := range req {
+		if i != len(ack)-1 {
+			out, err := assembler.append(ack[i], DefaultMaxMsgSize)
+			std.Assert(out == nil && err == nil, "ack should not complete before all fragments")
+		}
+		whole, err = assembler.append(req[i], DefaultMaxMsgSize)
+		std.AssertError(err, "append fragment")
+	}
+	std.Assert(whole != nil && whole.MethodName == "echo", "req should be reassembled")
+	std.Assert(len(assembler.buffers) == 1 && assembler.inflight > 0, "ack should still be in flight")
+	whole, err = assembler.append(ack[len(ack)-1], DefaultMaxMsgSize)
+	std.Assert(err == nil && whole != nil, "ack should be reassembled")
+	std.Assert(assembler.inflight == 0, "nothing in flight")
+
+	// peer announcing huge total can't make us allocate it
+	assembler = newFragmentAssembler()
+	lie := *req[0]
+	lie.Total = DefaultMaxMsgSize
+	_, err = assembler.append(&lie, DefaultMaxMsgSize)
+	std.AssertError(err, "append fragment with large total")
+	std.Assert(cap(assembler.buffers[fragmentKey{key: keyOf(&lie)}].data) < kFragmentSize*2, "buffer should grow as data arrives")
+
+	// partial msgs expire
+	assembler.expire(time.Now().Add(kFragmentExpire * 2))
+	std.Assert(len(assembler.buffers) == 0 && assembler.inflight == 0, "partial msg should expire")
+
+	// too large
+	_, err = assembler.append(req[0], len(msg.Data)/2)
+	std.Assert(err == ErrMsgTooLarge, "msg exceed max size should be rejected")
+}
+
+func TestJsonRpcParams(t *testing.T) {
+	msg := &RawMsg{Codec: CodecJson}
+	std.AssertError(msg.SetData([]int{1, 2, 3}), "set slice")
+	std.Assert(string(toJsonRpcParams(msg.Data, msg.args)) == "[[1,2,3]]", "slice should be single param")
+	std.AssertError(msg.SetData(Args{1, 2}), "set args")
+	std.Assert(string(toJsonRpcParams(msg.Data, msg.args)) == "[1,2]", "Args should be positional params")
+	std.AssertError(msg.SetData("temp"), "set string")
+	std.Assert(string(toJsonRpcParams(msg.Data, msg.args)) == `["temp"]`, "scalar should be wrapped")
+}
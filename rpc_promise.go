@@ -0,0 +1,66 @@
+package rpcx
+
+import (
+	"github.com/gen-iot/std"
+	"sync/atomic"
+	"time"
+)
+
+// callPromise implements std.Promise,
+// and expose done chan so that caller could select it with other events
+type callPromise struct {
+	msk  int32
+	done chan struct{}
+	data interface{}
+	err  error
+}
+
+func newCallPromise() *callPromise {
+	return &callPromise{
+		msk:  0,
+		done: make(chan struct{}),
+	}
+}
+
+func (this *callPromise) GetFuture() std.Future {
+	return this
+}
+
+func (this *callPromise) Wait(timeout time.Duration) error {
+	_, err := this.WaitData(timeout)
+	return err
+}
+
+func (this *callPromise) WaitData(timeout time.Duration) (interface{}, error) {
+	tm := time.NewTimer(timeout)
+	defer tm.Stop()
+	select {
+	case <-tm.C:
+		return nil, std.ErrFutureTimeout
+	case <-this.done:
+	}
+	return this.data, this.err
+}
+
+func (this *callPromise) Done(err error) {
+	this.DoneData(err, nil)
+}
+
+// only the first invoke take effect
+func (this *callPromise) DoneData(err error, data interface{}) {
+	if atomic.CompareAndSwapInt32(&this.msk, 0, 1) {
+		this.err = err
+		this.data = data
+		close(this.done)
+	}
+}
+
+// closed after promise done
+func (this *callPromise) DoneChan() <-chan struct{} {
+	return this.done
+}
+
+// only valid after DoneChan closed
+func (this *callPromise) Result() (interface{}, error) {
+	return this.data, this.err
+}
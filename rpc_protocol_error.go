@@ -0,0 +1,114 @@
+package rpcx
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gen-iot/std"
+	"log"
+	"sync/atomic"
+)
+
+var ErrProtocol = errors.New("rpcx protocol error")
+
+type ProtocolErrorKind int
+
+const (
+	ProtoErrBadHeader     ProtocolErrorKind = iota + 1 // bytes skipped to find next frame header
+	ProtoErrFrameTooLarge                              // frame exceed max body len
+	ProtoErrUnsupported                                // frame version or flags unknown
+	ProtoErrChecksum                                   // crc32 mismatched
+	ProtoErrDecompress                                 // compressed body broken
+	ProtoErrUnmarshal                                  // msg body broken
+	ProtoErrKindMismatch                               // frame kind differs from msg type
+)
+
+var gProtoErrKindNames = map[ProtocolErrorKind]string{
+	ProtoErrBadHeader:     "bad header",
+	ProtoErrFrameTooLarge: "frame too large",
+	ProtoErrUnsupported:   "unsupported frame",
+	ProtoErrChecksum:      "checksum mismatched",
+	ProtoErrDecompress:    "decompress failed",
+	ProtoErrUnmarshal:     "unmarshal failed",
+	ProtoErrKindMismatch:  "kind mismatched",
+}
+
+func (this ProtocolErrorKind) String() string {
+	if name, ok := gProtoErrKindNames[this]; ok {
+		return name
+	}
+	return fmt.Sprintf("kind(%d)", int(this))
+}
+
+// bad frame received from peer, bytes of it have been consumed.
+// errors.Is(err, ErrProtocol) is true for all of them
+type ProtocolError struct {
+	Kind   ProtocolErrorKind
+	Detail string
+}
+
+func newProtocolError(kind ProtocolErrorKind, format string, args ...interface{}) *ProtocolError {
+	return &ProtocolError{
+		Kind:   kind,
+		Detail: fmt.Sprintf(format, args...),
+	}
+}
+
+func (this *ProtocolError) Error() string {
+	return fmt.Sprintf("rpcx protocol error: %s, %s", this.Kind, this.Detail)
+}
+
+func (this *ProtocolError) Unwrap() error {
+	return ErrProtocol
+}
+
+type ProtocolErrorCallback func(callable Callable, err *ProtocolError)
+
+// protocol errors of one callable
+type protocolErrors struct {
+	count   uint64
+	maxErrs int32
+	broken  int32 // max errors reached, stop decoding
+	cb      ProtocolErrorCallback
+}
+
+// invoked after each bad frame received
+func (this *BaseCallable) SetOnProtocolError(cb ProtocolErrorCallback) {
+	this.protoErrs.cb = cb
+}
+
+// callable will be closed after n bad frames received, 0 means never close
+func (this *BaseCallable) SetMaxProtocolErrors(n int) {
+	atomic.StoreInt32(&this.protoErrs.maxErrs, int32(n))
+}
+
+// count of bad frames received
+func (this *BaseCallable) ProtocolErrors() uint64 {
+	return atomic.LoadUint64(&this.protoErrs.count)
+}
+
+// true if callable is being closed due to too many protocol errors
+func (this *BaseCallable) protocolBroken() bool {
+	return atomic.LoadInt32(&this.protoErrs.broken) == 1
+}
+
+// invoked in loop, returns true if decoding should stop
+func (this *BaseCallable) onProtocolError(err *ProtocolError) bool {
+	count := atomic.AddUint64(&this.protoErrs.count, 1)
+	log.Println("callable got ", err)
+	if this.protoErrs.cb != nil {
+		this.protoErrs.cb(this.delegate, err)
+	}
+	maxErrs := atomic.LoadInt32(&this.protoErrs.maxErrs)
+	if maxErrs <= 0 || count < uint64(maxErrs) {
+		return false
+	}
+	if !atomic.CompareAndSwapInt32(&this.protoErrs.broken, 0, 1) {
+		return true
+	}
+	log.Printf("callable got %d protocol errors, close it\n", count)
+	this.failPending(err)
+	this.core.Loop().RunInLoop(func() {
+		std.CloseIgnoreErr(this.delegate)
+	})
+	return true
+}
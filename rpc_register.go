@@ -0,0 +1,110 @@
+package rpcx
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+var ErrInvalidSignature = errors.New("invalid func signature")
+var ErrDuplicateFunc = errors.New("func already registered")
+
+// tells which param of func is wrong and why,
+// errors.Is(err, ErrInvalidSignature) is true
+type SignatureError struct {
+	Func   string
+	Param  string // e.g. in[0], out[1], empty if func itself is wrong
+	Reason string
+}
+
+func newSignatureError(param string, format string, args ...interface{}) *SignatureError {
+	return &SignatureError{
+		Param:  param,
+		Reason: fmt.Sprintf(format, args...),
+	}
+}
+
+func (this *SignatureError) Error() string {
+	if len(this.Param) == 0 {
+		return fmt.Sprintf("func `%s`: %s", this.Func, this.Reason)
+	}
+	return fmt.Sprintf("func `%s` %s: %s", this.Func, this.Param, this.Reason)
+}
+
+func (this *SignatureError) Unwrap() error {
+	return ErrInvalidSignature
+}
+
+func funcValueOf(fname string, f interface{}) (reflect.Value, error) {
+	fv, ok := f.(reflect.Value)
+	if !ok {
+		fv = reflect.ValueOf(f)
+	}
+	if fv.Kind() != reflect.Func || fv.IsNil() {
+		return fv, &SignatureError{Func: fname, Reason: fmt.Sprintf("not func, got %T", f)}
+	}
+	return fv, nil
+}
+
+func (this *coreImpl) buildFunc(fname string, f interface{}, m ...MiddlewareFunc) (*rpcFunc, error) {
+	fv, err := funcValueOf(fname, f)
+	if err != nil {
+		return nil, err
+	}
+	return newRpcFunc(fname, fv, m...)
+}
+
+// like RegFuncWithName, but never panic or overwrite,
+// *SignatureError returned if f is bad, ErrDuplicateFunc if fname used
+func (this *coreImpl) Register(fname string, f interface{}, m ...MiddlewareFunc) error {
+	fn, err := this.buildFunc(fname, f, m...)
+	if err != nil {
+		return err
+	}
+	return this.addFuncIfAbsent(fn)
+}
+
+func (this *coreImpl) addFuncIfAbsent(fn *rpcFunc) error {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if _, ok := this.rcpFuncMap[fn.name]; ok {
+		return fmt.Errorf("%w: `%s`", ErrDuplicateFunc, fn.name)
+	}
+	this.rcpFuncMap[fn.name] = fn
+	return nil
+}
+
+// like RegFunc, name derived from f
+func (this *coreImpl) RegisterFunc(f interface{}, m ...MiddlewareFunc) error {
+	fv, err := funcValueOf("", f)
+	if err != nil {
+		return err
+	}
+	return this.Register(getFuncName(fv), fv, m...)
+}
+
+// calls being handled are not affected, ErrFuncNotFound returned if fname not registered
+func (this *coreImpl) Unregister(fname string) error {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if _, ok := this.rcpFuncMap[fname]; !ok {
+		return fmt.Errorf("%w: `%s`", ErrFuncNotFound, fname)
+	}
+	delete(this.rcpFuncMap, fname)
+	return nil
+}
+
+// swap handler of registered fname atomically, calls being handled keep using old one
+func (this *coreImpl) Replace(fname string, f interface{}, m ...MiddlewareFunc) error {
+	fn, err := this.buildFunc(fname, f, m...)
+	if err != nil {
+		return err
+	}
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if _, ok := this.rcpFuncMap[fname]; !ok {
+		return fmt.Errorf("%w: `%s`", ErrFuncNotFound, fname)
+	}
+	this.rcpFuncMap[fname] = fn
+	return nil
+}
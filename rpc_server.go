@@ -0,0 +1,182 @@
+package rpcx
+
+import (
+	"github.com/gen-iot/liblpc/v2"
+	"github.com/gen-iot/std"
+	"log"
+	"sync"
+	"time"
+)
+
+const ServerDefaultBacklog = 1024
+
+const ServerDefaultHeartbeatMaxMiss = 3
+
+type ServerOptions struct {
+	Backlog   int
+	ReuseAddr bool
+	ReusePort bool
+	// middlewares applied on every accepted callable
+	Middlewares []MiddlewareFunc
+	// optional, idle callables will be closed by time wheel
+	TimeWheel *liblpc.TimeWheel
+	// optional, enable heartbeat of accepted callables if interval > 0
+	HeartbeatInterval time.Duration
+	HeartbeatMaxMiss  int
+	// optional, accepted callables must finish handshake before ready
+	Handshake *HandshakeOptions
+	// optional, accepted callables will be closed after n bad frames received
+	MaxProtocolErrors int
+	// optional, invoked after each bad frame received
+	OnProtocolError ProtocolErrorCallback
+	// optional, accepted callables speak JSON-RPC 2.0 if set, heartbeat and handshake are ignored
+	JsonRpc JsonRpcFraming
+	// invoked after accepted callable ready
+	OnConnect CallableCallback
+	// invoked after accepted callable closed
+	OnDisconnect CallableCallback
+}
+
+func DefaultServerOptions() *ServerOptions {
+	return &ServerOptions{
+		Backlog:   ServerDefaultBacklog,
+		ReuseAddr: true,
+		ReusePort: false,
+	}
+}
+
+// Server accept connections and owns all accepted callables,
+// close server will close listener and all of them together.
+type Server struct {
+	core      Core
+	opts      ServerOptions
+	listener  *liblpc.Listener
+	callables map[Callable]struct{}
+	lock      *sync.Mutex
+	closed    bool
+}
+
+// opts could be nil, use DefaultServerOptions instead
+func Listen(core Core, addr string, opts *ServerOptions) (*Server, error) {
+	std.Assert(core != nil, "core is nil")
+	if opts == nil {
+		opts = DefaultServerOptions()
+	}
+	backlog := opts.Backlog
+	if backlog <= 0 {
+		backlog = ServerDefaultBacklog
+	}
+	lfd, err := liblpc.NewListenerFd(addr, backlog, opts.ReuseAddr, opts.ReusePort)
+	if err != nil {
+		return nil, err
+	}
+	srv := &Server{
+		core:      core,
+		opts:      *opts,
+		callables: make(map[Callable]struct{}),
+		lock:      &sync.Mutex{},
+		closed:    false,
+	}
+	srv.listener = liblpc.NewListener(core.Loop(), int(lfd), srv.onAccept)
+	srv.listener.Start()
+	return srv, nil
+}
+
+func (this *Server) Core() Core {
+	return this.core
+}
+
+func (this *Server) onAccept(ln *liblpc.Listener, newFd int, err error) {
+	if err != nil {
+		log.Println("rpcx server accept error -> ", err)
+		return
+	}
+	call := NewConnStreamCallable(this.core, newFd, nil, this.opts.Middlewares...)
+	call.SetOnReady(this.onCallableReady)
+	call.SetOnClose(this.onCallableClose)
+	this.lock.Lock()
+	if this.closed {
+		this.lock.Unlock()
+		std.CloseIgnoreErr(call)
+		return
+	}
+	this.callables[call] = struct{}{}
+	this.lock.Unlock()
+	if this.opts.TimeWheel != nil {
+		call.BindTimeWheel(this.opts.TimeWheel)
+	}
+	if this.opts.JsonRpc != 0 {
+		call.SetJsonRpc(this.opts.JsonRpc)
+	}
+	if this.opts.HeartbeatInterval > 0 && this.opts.JsonRpc == 0 {
+		maxMiss := this.opts.HeartbeatMaxMiss
+		if maxMiss <= 0 {
+			maxMiss = ServerDefaultHeartbeatMaxMiss
+		}
+		call.SetHeartbeat(this.opts.HeartbeatInterval, maxMiss)
+	}
+	if this.opts.Handshake != nil && this.opts.JsonRpc == 0 {
+		call.SetHandshake(this.opts.Handshake)
+	}
+	call.SetMaxProtocolErrors(this.opts.MaxProtocolErrors)
+	call.SetOnProtocolError(this.opts.OnProtocolError)
+	call.Start()
+}
+
+func (this *Server) onCallableReady(call Callable, err error) {
+	if err != nil {
+		return
+	}
+	if this.opts.OnConnect != nil {
+		this.opts.OnConnect(call, nil)
+	}
+}
+
+func (this *Server) onCallableClose(call Callable, err error) {
+	this.lock.Lock()
+	_, ok := this.callables[call]
+	delete(this.callables, call)
+	this.lock.Unlock()
+	if ok && this.opts.OnDisconnect != nil {
+		this.opts.OnDisconnect(call, err)
+	}
+}
+
+// snapshot of current live callables
+func (this *Server) Callables() []Callable {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	out := make([]Callable, 0, len(this.callables))
+	for call := range this.callables {
+		out = append(out, call)
+	}
+	return out
+}
+
+func (this *Server) Len() int {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	return len(this.callables)
+}
+
+// close listener and all accepted callables, it's safe to invoke Close multi times.
+func (this *Server) Close() error {
+	this.lock.Lock()
+	if this.closed {
+		this.lock.Unlock()
+		return nil
+	}
+	this.closed = true
+	calls := make([]Callable, 0, len(this.callables))
+	for call := range this.callables {
+		calls = append(calls, call)
+	}
+	this.lock.Unlock()
+	this.core.Loop().RunInLoop(func() {
+		std.CloseIgnoreErr(this.listener)
+	})
+	for _, call := range calls {
+		std.CloseIgnoreErr(call)
+	}
+	return nil
+}
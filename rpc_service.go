@@ -0,0 +1,75 @@
+package rpcx
+
+import (
+	"fmt"
+	"github.com/gen-iot/std"
+	"log"
+	"reflect"
+	"strings"
+)
+
+type SkippedMethod struct {
+	Name   string
+	Reason string
+}
+
+// result of RegService
+type ServiceReport struct {
+	Name       string
+	Registered []string // full names, `Service.Method`
+	Skipped    []SkippedMethod
+}
+
+func (this *ServiceReport) String() string {
+	sb := &strings.Builder{}
+	_, _ = fmt.Fprintf(sb, "service %s: %d registered", this.Name, len(this.Registered))
+	for _, it := range this.Skipped {
+		_, _ = fmt.Fprintf(sb, "\n  skipped %s: %s", it.Name, it.Reason)
+	}
+	return sb.String()
+}
+
+// methods don't match supported signatures or already registered are skipped instead of panic or overwrite,
+// name of receiver type is used if name is empty
+func (this *coreImpl) RegService(name string, receiver interface{}, m ...MiddlewareFunc) *ServiceReport {
+	rv := reflect.ValueOf(receiver)
+	std.Assert(rv.IsValid() && !(rv.Kind() == reflect.Ptr && rv.IsNil()), "receiver is nil")
+	if len(name) == 0 {
+		name = reflect.Indirect(rv).Type().Name()
+	}
+	std.Assert(len(name) != 0, "service name is empty")
+	report := &ServiceReport{
+		Name:       name,
+		Registered: make([]string, 0),
+		Skipped:    make([]SkippedMethod, 0),
+	}
+	rt := rv.Type()
+	for i := 0; i < rt.NumMethod(); i++ {
+		method := rt.Method(i)
+		fn, err := newRpcFunc(name+"."+method.Name, rv.Method(i), m...)
+		if err != nil {
+			sigErr := err.(*SignatureError)
+			reason := sigErr.Reason
+			if len(sigErr.Param) != 0 {
+				reason = sigErr.Param + ": " + reason
+			}
+			report.Skipped = append(report.Skipped, SkippedMethod{
+				Name:   method.Name,
+				Reason: reason,
+			})
+			continue
+		}
+		if err := this.addFuncIfAbsent(fn); err != nil {
+			report.Skipped = append(report.Skipped, SkippedMethod{
+				Name:   method.Name,
+				Reason: ErrDuplicateFunc.Error(),
+			})
+			continue
+		}
+		report.Registered = append(report.Registered, fn.name)
+	}
+	if len(report.Skipped) != 0 {
+		log.Println(report)
+	}
+	return report
+}
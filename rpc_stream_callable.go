@@ -12,8 +12,9 @@ type streamCallImpl struct {
 
 func (this *streamCallImpl) Start() {
 	std.Assert(this.stream != nil, "stream is nil")
-	this.BaseCallable.Start()
+	// heartbeat pings write to stream, start it after stream started
 	this.stream.Start()
+	this.BaseCallable.Start()
 }
 
 type bufferedStreamWrapper struct {
@@ -53,9 +54,7 @@ func NewConnStreamCallable(core Core, fd int, userData interface{}, m ...Middlew
 	pCall := newStreamCall(core, stream, userData, m...)
 	//
 	stream.SetOnConnect(func(sw liblpc.StreamWriter, err error) {
-		if pCall.readyCb != nil {
-			pCall.readyCb(pCall, err)
-		}
+		pCall.ready(err)
 		if err != nil {
 			std.CloseIgnoreErr(pCall)
 		}
@@ -0,0 +1,414 @@
+package rpcx
+
+import (
+	"context"
+	"errors"
+	"github.com/gen-iot/std"
+	"io"
+	"log"
+	"sync"
+	"sync/atomic"
+)
+
+// count of messages one side could send before peer grant more credits
+const StreamWindow = 64
+
+var ErrStreamSendClosed = errors.New("stream send closed")
+var ErrStreamFinished = errors.New("stream finished by callee")
+var errStreamNotSupport = errors.New("callable not support stream")
+var errNotStreamCall = errors.New("stream func must be invoked by OpenStream")
+
+// both callee handler and caller use Stream to exchange messages
+//
+// callee handler formal: func Function(ctx rpcx.Context, stream rpcx.Stream) (err error)
+type Stream interface {
+	// block until peer grant credits
+	Send(v interface{}) error
+	// return io.EOF after peer finished sending
+	Recv(v interface{}) error
+	// half close, peer Recv got io.EOF
+	CloseSend() error
+}
+
+// caller side stream, callee finished when Recv returns io.EOF or error
+type ClientStream interface {
+	Stream
+	// headers of callee ack, only valid after Recv returns io.EOF
+	AckHeader() RpcMsgHeader
+	// bind out param returned by callee stream func, only valid after Recv returns io.EOF
+	BindAck(out interface{}) error
+	// abort stream, callee ctx will be canceled
+	io.Closer
+}
+
+type streamImpl struct {
+	id         string
+	seq        uint64
+	method     string
+	codec      string
+	maxMsgSize int
+	encoder    frameEncoder
+	fromCallee bool
+	writer     Writer
+	goCtx      context.Context
+	recvQ      chan *RawMsg
+	peerEnd    <-chan struct{}
+	peerErr    func() error
+	sendAbort  <-chan struct{}
+	credit     int32
+	creditSig  chan struct{}
+	consumed   int32
+	sendClosed int32
+}
+
+// stream frames use the same codec as open msg
+func newStreamImpl(core Core, openMsg *RawMsg, fromCallee bool, call Callable, goCtx context.Context) *streamImpl {
+	return &streamImpl{
+		id:         openMsg.Id,
+		seq:        openMsg.Seq,
+		method:     openMsg.MethodName,
+		codec:      openMsg.Codec,
+		maxMsgSize: core.MaxMsgSize(),
+		encoder:    encoderOf(call, openMsg.MethodName),
+		fromCallee: fromCallee,
+		writer:     call.Writer(),
+		goCtx:      goCtx,
+		recvQ:      make(chan *RawMsg, StreamWindow),
+		credit:     StreamWindow,
+		creditSig:  make(chan struct{}, 1),
+	}
+}
+
+func (this *streamImpl) write(msgType MsgType, v interface{}, credit uint32) error {
+	msg := &RawMsg{
+		Id:         this.id,
+		Seq:        this.seq,
+		MethodName: this.method,
+		Type:       msgType,
+		FromCallee: this.fromCallee,
+		Credit:     credit,
+		Codec:      this.codec,
+	}
+	if err := msg.SetData(v); err != nil {
+		return err
+	}
+	frames, err := encodeRpcFrames(msg, this.maxMsgSize, this.encoder)
+	if err != nil {
+		return err
+	}
+	writeFrames(this.writer, nil, frames)
+	return nil
+}
+
+// error when stream could not send/recv anymore
+func (this *streamImpl) abortErr() error {
+	select {
+	case <-this.goCtx.Done():
+		return this.goCtx.Err()
+	default:
+		return nil
+	}
+}
+
+func (this *streamImpl) Send(v interface{}) error {
+	if atomic.LoadInt32(&this.sendClosed) != 0 {
+		return ErrStreamSendClosed
+	}
+	for {
+		if credit := atomic.LoadInt32(&this.credit); credit > 0 {
+			if atomic.CompareAndSwapInt32(&this.credit, credit, credit-1) {
+				break
+			}
+			continue
+		}
+		select {
+		case <-this.creditSig:
+		case <-this.goCtx.Done():
+			return this.goCtx.Err()
+		case <-this.sendAbort:
+			return ErrStreamFinished
+		}
+	}
+	if err := this.abortErr(); err != nil {
+		return err
+	}
+	return this.write(StreamDataMsg, v, 0)
+}
+
+func (this *streamImpl) Recv(v interface{}) error {
+	var msg *RawMsg = nil
+	var err error = nil
+	select {
+	case msg = <-this.recvQ:
+	default:
+		select {
+		case msg = <-this.recvQ:
+		case <-this.peerEnd:
+			msg, err = this.drain()
+		case <-this.goCtx.Done():
+			select {
+			case <-this.peerEnd:
+				// peer finished before ctx done
+				msg, err = this.drain()
+			default:
+				err = this.goCtx.Err()
+			}
+		}
+	}
+	if err != nil {
+		return err
+	}
+	this.consume()
+	if v == nil {
+		return nil
+	}
+	return msg.BindData(v)
+}
+
+// frames before peer end have been queued, drain them first
+func (this *streamImpl) drain() (*RawMsg, error) {
+	select {
+	case msg := <-this.recvQ:
+		return msg, nil
+	default:
+		return nil, this.peerErr()
+	}
+}
+
+// grant credits back to peer
+func (this *streamImpl) consume() {
+	consumed := atomic.AddInt32(&this.consumed, 1)
+	if consumed < StreamWindow/2 {
+		return
+	}
+	if !atomic.CompareAndSwapInt32(&this.consumed, consumed, 0) {
+		return
+	}
+	if err := this.write(StreamCreditMsg, nil, uint32(consumed)); err != nil {
+		log.Printf("stream [%s]:send credit error -> %v\n", this.method, err)
+	}
+}
+
+func (this *streamImpl) CloseSend() error {
+	if !atomic.CompareAndSwapInt32(&this.sendClosed, 0, 1) {
+		return nil
+	}
+	if this.fromCallee {
+		return nil // callee finish sending by returning from handler
+	}
+	return this.write(StreamEndMsg, nil, 0)
+}
+
+// invoked in loop
+func (this *streamImpl) onFrame(msg *RawMsg) {
+	switch msg.Type {
+	case StreamDataMsg:
+		select {
+		case this.recvQ <- msg:
+		default:
+			log.Printf("stream [%s]:peer exceed flow control window, frame dropped\n", this.method)
+		}
+	case StreamCreditMsg:
+		atomic.AddInt32(&this.credit, int32(msg.Credit))
+		select {
+		case this.creditSig <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// callee side stream
+type acceptedStream struct {
+	*streamImpl
+	endC    chan struct{}
+	endOnce sync.Once
+}
+
+func newAcceptedStream(core Core, ctx Context, msg *RawMsg) *acceptedStream {
+	stream := &acceptedStream{
+		streamImpl: newStreamImpl(core, msg, true, ctx.Callable(), ctx.GoContext()),
+		endC:       make(chan struct{}),
+	}
+	stream.peerEnd = stream.endC
+	stream.peerErr = func() error {
+		return io.EOF
+	}
+	return stream
+}
+
+func (this *acceptedStream) onFrame(msg *RawMsg) {
+	if msg.Type == StreamEndMsg {
+		this.endOnce.Do(func() {
+			close(this.endC)
+		})
+		return
+	}
+	this.streamImpl.onFrame(msg)
+}
+
+// caller side stream
+type openedStream struct {
+	*streamImpl
+	call    *BaseCallable
+	promise *callPromise
+	cancel  context.CancelFunc
+	ackMsg  *RawMsg
+}
+
+func (this *openedStream) AckHeader() RpcMsgHeader {
+	if this.ackMsg == nil {
+		return nil
+	}
+	return this.ackMsg.Headers
+}
+
+func (this *openedStream) BindAck(out interface{}) error {
+	if this.ackMsg == nil || len(this.ackMsg.Data) == 0 {
+		return nil
+	}
+	return this.ackMsg.BindData(out)
+}
+
+func (this *openedStream) Close() error {
+	this.cancel()
+	return nil
+}
+
+func (this *openedStream) finishErr() error {
+	data, err := this.promise.Result()
+	if ackMsg, ok := data.(*RawMsg); ok {
+		this.ackMsg = ackMsg
+	}
+	if err != nil {
+		return err
+	}
+	return io.EOF
+}
+
+// release stream after callee finished or caller gave up
+func (this *openedStream) watch() {
+	key := msgKey{id: this.id, seq: this.seq}
+	defer func() {
+		this.call.streams.remove(key, false)
+		this.call.pending.remove(key)
+		this.cancel()
+	}()
+	select {
+	case <-this.promise.DoneChan():
+	case <-this.goCtx.Done():
+		cancelBytes, err := this.call.encodeMsg(&RawMsg{
+			Id:         this.id,
+			Seq:        this.seq,
+			MethodName: this.method,
+			Type:       CancelMsg,
+		})
+		if err == nil && this.writer != nil {
+			this.writer.Write(nil, cancelBytes, false)
+		}
+	}
+}
+
+// goCtx controls the whole stream lifetime
+func (this *BaseCallable) OpenStream(goCtx context.Context, name string, headers RpcMsgHeader) (ClientStream, error) {
+	std.Assert(goCtx != nil, "goCtx is nil")
+	std.Assert(this.writer != nil, "stream is nil!")
+	if err := goCtx.Err(); err != nil {
+		return nil, err
+	}
+	if !this.handshakeReady() {
+		return nil, ErrHandshakeRequired
+	}
+	if this.peerLacks(FeatureStream) {
+		return nil, ErrFeatureUnsupported
+	}
+	msgId, seq := this.nextMsgId()
+	msg := &RawMsg{
+		Id:         msgId,
+		Seq:        seq,
+		MethodName: name,
+		Headers:    headers,
+		Type:       StreamOpenMsg,
+		Codec:      codecName(this.core.Codec()),
+	}
+	if deadline, ok := goCtx.Deadline(); ok {
+		msg.Timeout = remainingMilliseconds(deadline)
+	}
+	openBytes, err := this.encodeMsg(msg)
+	if err != nil {
+		return nil, err
+	}
+	streamCtx, cancel := context.WithCancel(goCtx)
+	stream := &openedStream{
+		streamImpl: newStreamImpl(this.core, msg, false, this, streamCtx),
+		call:       this,
+		promise:    newCallPromise(),
+		cancel:     cancel,
+	}
+	stream.peerEnd = stream.promise.DoneChan()
+	stream.peerErr = stream.finishErr
+	stream.sendAbort = stream.promise.DoneChan()
+	key := keyOf(msg)
+	if !this.pending.add(key, pendingCall{promise: stream.promise}) {
+		cancel()
+		return nil, ErrCallableClosed
+	}
+	this.streams.add(key, false, stream)
+	go stream.watch()
+	this.writer.Write(nil, openBytes, false)
+	return stream, nil
+}
+
+type streamFrameHandler interface {
+	onFrame(msg *RawMsg)
+}
+
+// streams of one callable, opened by local or accepted from remote
+type streamRegistry struct {
+	opened   map[msgKey]streamFrameHandler
+	accepted map[msgKey]streamFrameHandler
+	lock     *sync.Mutex
+}
+
+func newStreamRegistry() *streamRegistry {
+	return &streamRegistry{
+		opened:   make(map[msgKey]streamFrameHandler),
+		accepted: make(map[msgKey]streamFrameHandler),
+		lock:     &sync.Mutex{},
+	}
+}
+
+func (this *streamRegistry) add(key msgKey, accepted bool, stream streamFrameHandler) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if accepted {
+		this.accepted[key] = stream
+	} else {
+		this.opened[key] = stream
+	}
+}
+
+func (this *streamRegistry) remove(key msgKey, accepted bool) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if accepted {
+		delete(this.accepted, key)
+	} else {
+		delete(this.opened, key)
+	}
+}
+
+// frames sent by callee belong to streams opened by local
+func (this *streamRegistry) dispatch(msg *RawMsg) {
+	this.lock.Lock()
+	var stream streamFrameHandler = nil
+	if msg.FromCallee {
+		stream = this.opened[keyOf(msg)]
+	} else {
+		stream = this.accepted[keyOf(msg)]
+	}
+	this.lock.Unlock()
+	if stream == nil {
+		return
+	}
+	stream.onFrame(msg)
+}
@@ -16,10 +16,14 @@ func NewVirtualCallable(core Core, writer WriterCloser) *VirtualCallable {
 
 func (this *VirtualCallable) Start() {
 	this.BaseCallable.Start()
-	this.DoReady(nil)
+	this.ready(nil)
 }
 
 func (this *VirtualCallable) Close() error {
+	this.stopHeartbeat()
+	this.workers.set(nil)
+	this.failPending(ErrCallableClosed)
+	this.inflight.cancelAll()
 	this.DoClosed(nil)
 	return nil
 }
@@ -0,0 +1,259 @@
+package rpcx
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+const DefaultPoolWorkers = 128
+const DefaultPoolQueueSize = 1024
+
+var ErrBusy = errors.New("callee busy, request rejected")
+
+// what to do with request when all workers busy and queue is full
+type OverloadPolicy int
+
+const (
+	// ack caller with ErrBusy, notifications dropped
+	OverloadReject OverloadPolicy = iota
+	// stop reading until queue has room, blocks the event loop of core.
+	// handlers calling back through the same core may dead lock until call timeout
+	OverloadBlock
+	// drop silently, caller waits until timeout
+	OverloadDrop
+)
+
+type WorkerPoolOptions struct {
+	Workers   int // DefaultPoolWorkers if <= 0
+	QueueSize int // requests waiting for worker, DefaultPoolQueueSize if <= 0
+	Policy    OverloadPolicy
+}
+
+type WorkerPoolStats struct {
+	Workers   int
+	QueueSize int
+	Queued    int // current queue depth
+	MaxQueued int // peak queue depth
+	Running   int // requests being handled
+	Handled   uint64
+	Rejected  uint64
+	Dropped   uint64
+	Blocked   uint64 // requests which blocked reading before queued
+}
+
+// bounded workers handling requests, stream handlers hold a worker until stream closed
+type workerPool struct {
+	opts      WorkerPoolOptions
+	queue     chan func()
+	quit      chan struct{}
+	lock      sync.RWMutex
+	closed    bool
+	running   int32
+	maxQueued int32
+	handled   uint64
+	rejected  uint64
+	dropped   uint64
+	blocked   uint64
+}
+
+func newWorkerPool(opts *WorkerPoolOptions) *workerPool {
+	pool := &workerPool{
+		opts: *opts,
+		quit: make(chan struct{}),
+	}
+	if pool.opts.Workers <= 0 {
+		pool.opts.Workers = DefaultPoolWorkers
+	}
+	if pool.opts.QueueSize <= 0 {
+		pool.opts.QueueSize = DefaultPoolQueueSize
+	}
+	pool.queue = make(chan func(), pool.opts.QueueSize)
+	for i := 0; i < pool.opts.Workers; i++ {
+		go pool.work()
+	}
+	return pool
+}
+
+func (this *workerPool) work() {
+	for {
+		select {
+		case task := <-this.queue:
+			this.run(task)
+		case <-this.quit:
+			// nothing queued after quit, drain and exit
+			for {
+				select {
+				case task := <-this.queue:
+					this.run(task)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (this *workerPool) run(task func()) {
+	atomic.AddInt32(&this.running, 1)
+	defer func() {
+		atomic.AddInt32(&this.running, -1)
+		atomic.AddUint64(&this.handled, 1)
+	}()
+	task()
+}
+
+// false if task rejected or dropped by policy, caller should release resources of task
+func (this *workerPool) submit(task func()) bool {
+	this.lock.RLock()
+	defer this.lock.RUnlock()
+	if this.closed {
+		// pool replaced while dispatching
+		go task()
+		return true
+	}
+	select {
+	case this.queue <- task:
+	default:
+		switch this.opts.Policy {
+		case OverloadBlock:
+			atomic.AddUint64(&this.blocked, 1)
+			this.queue <- task
+		case OverloadDrop:
+			atomic.AddUint64(&this.dropped, 1)
+			return false
+		default:
+			atomic.AddUint64(&this.rejected, 1)
+			return false
+		}
+	}
+	this.updateMaxQueued()
+	return true
+}
+
+// queue task only if there is room, never blocks and never counted as overload
+func (this *workerPool) trySubmit(task func()) bool {
+	this.lock.RLock()
+	defer this.lock.RUnlock()
+	if this.closed {
+		return false
+	}
+	select {
+	case this.queue <- task:
+		this.updateMaxQueued()
+		return true
+	default:
+		return false
+	}
+}
+
+func (this *workerPool) updateMaxQueued() {
+	queued := int32(len(this.queue))
+	for {
+		peak := atomic.LoadInt32(&this.maxQueued)
+		if queued <= peak || atomic.CompareAndSwapInt32(&this.maxQueued, peak, queued) {
+			break
+		}
+	}
+}
+
+// queued requests still handled, workers exit after that
+func (this *workerPool) close() {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if this.closed {
+		return
+	}
+	this.closed = true
+	close(this.quit)
+}
+
+func (this *workerPool) stats() *WorkerPoolStats {
+	return &WorkerPoolStats{
+		Workers:   this.opts.Workers,
+		QueueSize: this.opts.QueueSize,
+		Queued:    len(this.queue),
+		MaxQueued: int(atomic.LoadInt32(&this.maxQueued)),
+		Running:   int(atomic.LoadInt32(&this.running)),
+		Handled:   atomic.LoadUint64(&this.handled),
+		Rejected:  atomic.LoadUint64(&this.rejected),
+		Dropped:   atomic.LoadUint64(&this.dropped),
+		Blocked:   atomic.LoadUint64(&this.blocked),
+	}
+}
+
+type workerPoolHolder struct {
+	pool atomic.Value // *workerPool
+	lock sync.Mutex   // serializes set
+}
+
+// nil opts disables pool, previous pool closed after queued requests handled
+func (this *workerPoolHolder) set(opts *WorkerPoolOptions) {
+	var pool *workerPool = nil
+	if opts != nil {
+		pool = newWorkerPool(opts)
+	}
+	this.lock.Lock()
+	old := this.get()
+	this.pool.Store(pool)
+	this.lock.Unlock()
+	if old != nil {
+		old.close()
+	}
+}
+
+func (this *workerPoolHolder) get() *workerPool {
+	pool, _ := this.pool.Load().(*workerPool)
+	return pool
+}
+
+// nil if pool disabled
+func (this *workerPoolHolder) stats() *WorkerPoolStats {
+	if pool := this.get(); pool != nil {
+		return pool.stats()
+	}
+	return nil
+}
+
+func (this *coreImpl) SetWorkerPool(opts *WorkerPoolOptions) {
+	this.workers.set(opts)
+}
+
+func (this *coreImpl) WorkerPoolStats() *WorkerPoolStats {
+	return this.workers.stats()
+}
+
+// requests of this callable handled by its own pool instead of core pool, nil falls back to core pool
+func (this *BaseCallable) SetWorkerPool(opts *WorkerPoolOptions) {
+	this.workers.set(opts)
+}
+
+func (this *BaseCallable) WorkerPoolStats() *WorkerPoolStats {
+	return this.workers.stats()
+}
+
+// pool of callable preferred, core pool used if not set, unbounded goroutines if neither set
+func (this *coreImpl) poolOf(call Callable) *workerPool {
+	if base := baseOf(call); base != nil {
+		if pool := base.workers.get(); pool != nil {
+			return pool
+		}
+	}
+	return this.workers.get()
+}
+
+// run task on pool of call, rejected request acked with ErrBusy
+func (this *coreImpl) runTask(call Callable, rawMsg *RawMsg, task func(), release func()) {
+	pool := this.poolOf(call)
+	if pool == nil {
+		go task()
+		return
+	}
+	if pool.submit(task) {
+		return
+	}
+	release()
+	if pool.opts.Policy == OverloadReject && rawMsg.Type != NotifyMsg {
+		this.ackError(call, rawMsg, ErrBusy)
+	}
+}
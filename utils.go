@@ -1,7 +1,8 @@
 package rpcx
 
 import (
-	"github.com/gen-iot/std"
+	"context"
+	"fmt"
 	"reflect"
 	"runtime"
 	"strings"
@@ -10,48 +11,74 @@ import (
 
 var typeOfError = reflect.TypeOf((*error)(nil)).Elem()
 var typeOfContext = reflect.TypeOf((*Context)(nil)).Elem()
+var typeOfStream = reflect.TypeOf((*Stream)(nil)).Elem()
+var typeOfGoContext = reflect.TypeOf((*context.Context)(nil)).Elem()
+var typeOfArgs = reflect.TypeOf(Args{})
 
-func checkInParam(t reflect.Type) (reflect.Type, FuncDesc) {
+// return types of in params after context
+func checkInParam(t reflect.Type) ([]reflect.Type, FuncDesc, error) {
 	fnInDesc := FuncDesc(0)
 	inNum := t.NumIn()
-	var inParamType reflect.Type = nil
-	std.Assert(inNum > 0 && inNum <= 2, "inNum len must less or equal than 2")
-	//
-	in0 := t.In(0)
-	std.Assert(in0 == typeOfContext, "first in param must be rpcx.Context")
-	//
-	switch inNum {
-	case 1:
+	if inNum == 0 {
+		return nil, 0, newSignatureError("in[0]", "missing, must be rpcx.Context or context.Context")
+	}
+	switch t.In(0) {
+	case typeOfContext:
+	case typeOfGoContext:
+		// func foo(context.Context,...)
+		fnInDesc = ReqGoContext
+	default:
+		return nil, 0, newSignatureError("in[0]", "must be rpcx.Context or context.Context, got %s", t.In(0))
+	}
+	if t.IsVariadic() {
+		return nil, 0, newSignatureError(fmt.Sprintf("in[%d]", inNum-1), "variadic param not supported")
+	}
+	inParamTypes := make([]reflect.Type, 0, inNum-1)
+	for i := 1; i < inNum; i++ {
+		if t.In(i) == typeOfStream && inNum != 2 {
+			return nil, 0, newSignatureError(fmt.Sprintf("in[%d]", i), "rpcx.Stream must be the only param after context")
+		}
+		inParamTypes = append(inParamTypes, t.In(i))
+	}
+	switch len(inParamTypes) {
+	case 0:
 		// func foo(context)
-		fnInDesc = 0
-	case 2:
+	case 1:
 		// func foo(context,param1)
-		fnInDesc = ReqHasData
-		in1 := t.In(1)
-		inParamType = in1
+		fnInDesc |= ReqHasData
+		if inParamTypes[0] == typeOfStream {
+			// func foo(context,stream)
+			fnInDesc = fnInDesc&^ReqHasData | ReqStream
+		}
 	default:
-		std.Assert(false, "illegal func in params num")
+		// func foo(context,param1,param2...)
+		fnInDesc |= ReqHasData | ReqMultiArgs
 	}
-	return inParamType, fnInDesc
+	return inParamTypes, fnInDesc, nil
 }
 
-func checkOutParam(t reflect.Type) (reflect.Type, FuncDesc) {
-	outNum := t.NumOut()
-	fnOutDesc := FuncDesc(0)
-	var outParamType reflect.Type = nil
-	switch outNum {
+// return out type, index of error in out params (-1 if no error)
+func checkOutParam(t reflect.Type) (reflect.Type, FuncDesc, int, error) {
+	switch t.NumOut() {
+	case 0:
+		// func foo(...)
+		return nil, 0, -1, nil
 	case 1:
-		out1 := t.Out(0)
-		std.Assert(out1 == typeOfError, "first param of out_param ,type must be `error`")
+		if t.Out(0) == typeOfError {
+			// func foo(...) error
+			return nil, 0, 0, nil
+		}
+		// func foo(...) out
+		return t.Out(0), RspHasData, -1, nil
 	case 2:
-		fnOutDesc = RspHasData
-		outParamType = t.Out(0)
-		out1 := t.Out(1)
-		std.Assert(out1 == typeOfError, "last param of out_param ,type must be `error`")
+		if t.Out(1) != typeOfError {
+			return nil, 0, -1, newSignatureError("out[1]", "must be error, got %s", t.Out(1))
+		}
+		// func foo(...) (out, error)
+		return t.Out(0), RspHasData, 1, nil
 	default:
-		std.Assert(false, "illegal func return params num")
+		return nil, 0, -1, newSignatureError("out", "got %d params, at most (out, error)", t.NumOut())
 	}
-	return outParamType, fnOutDesc
 }
 
 func getFuncName(fv reflect.Value) string {